@@ -0,0 +1,228 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+)
+
+// 日志格式
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Config 访问日志配置
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Format 日志格式 json | logfmt
+	Format string `mapstructure:"format"`
+	// Output 输出位置 stdout | stderr | 文件路径
+	Output string `mapstructure:"output"`
+	// MaxSizeMB 日志文件达到该大小(MB)后轮转 为 0 时不轮转 仅对文件输出生效
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxBackups 保留的轮转文件数 为 0 时全部保留
+	MaxBackups int `mapstructure:"max_backups"`
+	// Body 请求/响应消息记录
+	Body BodyConfig `mapstructure:"body"`
+}
+
+// BodyConfig 请求/响应消息记录配置 流式调用仅记录服务端流的请求消息
+type BodyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxBytes 单个消息记录的最大字节数 超出部分截断
+	MaxBytes int `mapstructure:"max_bytes"`
+	// RedactFields 额外脱敏的字段 字段全名(如 demo.v1.User.password)或字段名
+	// proto 中标记 debug_redact 的字段总会脱敏
+	RedactFields []string `mapstructure:"redact_fields"`
+}
+
+// DefaultConfig 默认访问日志配置 默认关闭
+func DefaultConfig() Config {
+	return Config{
+		Format:     FormatJSON,
+		Output:     "stdout",
+		MaxSizeMB:  100,
+		MaxBackups: 5,
+		Body:       BodyConfig{MaxBytes: 4096},
+	}
+}
+
+// Entry 一条访问日志
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route,omitempty"`       // 路由模板 未匹配路由时为空
+	Service    string    `json:"service,omitempty"`     // 服务名
+	FullMethod string    `json:"full_method,omitempty"` // gRPC 方法全名
+	Upstream   string    `json:"upstream,omitempty"`    // 处理请求的实例地址 未调用上游时为空
+	Status     int       `json:"status"`
+	GRPCCode   string    `json:"grpc_code,omitempty"` // 上游调用的 gRPC 状态码 未调用上游时为空
+	DurationMS float64   `json:"duration_ms"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	// RequestBody / ResponseBody 脱敏后的消息 JSON 仅开启 body 记录时输出
+	RequestBody  string `json:"request_body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+}
+
+// Logger 访问日志 并发安全
+type Logger struct {
+	format string
+	body   BodyConfig
+	redact map[string]struct{}
+
+	mu  sync.Mutex
+	out io.Writer
+	buf []byte
+}
+
+// New 按配置创建访问日志
+func New(conf Config) (*Logger, error) {
+	format := strings.ToLower(strings.TrimSpace(conf.Format))
+	switch format {
+	case "":
+		format = FormatJSON
+	case FormatJSON, FormatLogfmt:
+	default:
+		return nil, fmt.Errorf("unsupported format %q, expected json or logfmt", conf.Format)
+	}
+
+	var out io.Writer
+	switch output := strings.TrimSpace(conf.Output); output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		f, err := openRotatingFile(output, int64(conf.MaxSizeMB)<<20, conf.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open access log: %w", err)
+		}
+		out = f
+	}
+
+	l := &Logger{format: format, body: conf.Body, out: out}
+	if l.body.MaxBytes <= 0 {
+		l.body.MaxBytes = DefaultConfig().Body.MaxBytes
+	}
+	if len(conf.Body.RedactFields) > 0 {
+		l.redact = make(map[string]struct{}, len(conf.Body.RedactFields))
+		for _, f := range conf.Body.RedactFields {
+			if f = strings.TrimSpace(f); f != "" {
+				l.redact[f] = struct{}{}
+			}
+		}
+	}
+	return l, nil
+}
+
+// CaptureBody 是否记录请求/响应消息
+func (l *Logger) CaptureBody() bool {
+	return l.body.Enabled
+}
+
+// Log 写出一条访问日志
+func (l *Logger) Log(e *Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	if l.format == FormatLogfmt {
+		l.buf = appendLogfmt(l.buf[:0], e)
+	} else {
+		var b []byte
+		b, err = sonic.Marshal(e)
+		l.buf = append(append(l.buf[:0], b...), '\n')
+	}
+	if err == nil {
+		_, err = l.out.Write(l.buf)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write access log: %v\n", err)
+	}
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.out.(io.Closer); ok && l.out != os.Stdout && l.out != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+// appendLogfmt 以 logfmt 格式编码 字段顺序与 JSON 一致 空的可选字段省略
+func appendLogfmt(b []byte, e *Entry) []byte {
+	b = appendPair(b, "time", e.Time.Format(time.RFC3339Nano))
+	b = appendPair(b, "request_id", e.RequestID)
+	b = appendPair(b, "client_ip", e.ClientIP)
+	b = appendPair(b, "method", e.Method)
+	b = appendPair(b, "path", e.Path)
+	for _, kv := range [...][2]string{
+		{"route", e.Route},
+		{"service", e.Service},
+		{"full_method", e.FullMethod},
+		{"upstream", e.Upstream},
+	} {
+		if kv[1] != "" {
+			b = appendPair(b, kv[0], kv[1])
+		}
+	}
+	b = appendPair(b, "status", strconv.Itoa(e.Status))
+	if e.GRPCCode != "" {
+		b = appendPair(b, "grpc_code", e.GRPCCode)
+	}
+	b = appendPair(b, "duration_ms", strconv.FormatFloat(e.DurationMS, 'f', -1, 64))
+	b = appendPair(b, "bytes_in", strconv.FormatInt(e.BytesIn, 10))
+	b = appendPair(b, "bytes_out", strconv.FormatInt(e.BytesOut, 10))
+	for _, kv := range [...][2]string{
+		{"user_agent", e.UserAgent},
+		{"trace_id", e.TraceID},
+		{"request_body", e.RequestBody},
+		{"response_body", e.ResponseBody},
+	} {
+		if kv[1] != "" {
+			b = appendPair(b, kv[0], kv[1])
+		}
+	}
+	b[len(b)-1] = '\n'
+	return b
+}
+
+// appendPair 追加 key=value 含空白、引号、等号或不可打印字符的值加引号
+func appendPair(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	b = append(b, '=')
+	if needsQuote(value) {
+		b = strconv.AppendQuote(b, value)
+	} else {
+		b = append(b, value...)
+	}
+	return append(b, ' ')
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package accesslog
+
+import (
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// redacted 脱敏字段的替代值
+const redacted = "[REDACTED]"
+
+// TypeResolver 编码 Any 等类型时使用的类型解析器
+type TypeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// Body 将消息编码为脱敏后的 JSON 超出 MaxBytes 时截断 msg 为 nil 时返回空
+// 脱敏按 JSON 结构进行 嵌套消息、repeated 与 map 值中的字段同样处理 Any 中的消息不处理
+func (l *Logger) Body(msg proto.Message, resolver TypeResolver) string {
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return ""
+	}
+	b, err := protojson.MarshalOptions{Resolver: resolver}.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+	desc := msg.ProtoReflect().Descriptor()
+	if l.hasRedacted(desc, make(map[protoreflect.FullName]bool)) {
+		var v any
+		if err := sonic.Unmarshal(b, &v); err != nil {
+			return ""
+		}
+		l.redactValue(desc, v)
+		if b, err = sonic.ConfigStd.Marshal(v); err != nil {
+			return ""
+		}
+	}
+	if len(b) > l.body.MaxBytes {
+		return string(b[:l.body.MaxBytes]) + "...(truncated)"
+	}
+	return string(b)
+}
+
+// isRedacted 字段是否需要脱敏
+func (l *Logger) isRedacted(fd protoreflect.FieldDescriptor) bool {
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDebugRedact() {
+		return true
+	}
+	if l.redact == nil {
+		return false
+	}
+	if _, ok := l.redact[string(fd.FullName())]; ok {
+		return true
+	}
+	_, ok := l.redact[string(fd.Name())]
+	return ok
+}
+
+// hasRedacted 消息(含嵌套消息)中是否存在需要脱敏的字段 seen 用于处理递归消息
+func (l *Logger) hasRedacted(desc protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool) bool {
+	if seen[desc.FullName()] {
+		return false
+	}
+	seen[desc.FullName()] = true
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if l.isRedacted(fd) {
+			return true
+		}
+		if m := fieldMessage(fd); m != nil && l.hasRedacted(m, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue 按描述符替换 JSON 对象中需要脱敏的字段
+func (l *Logger) redactValue(desc protoreflect.MessageDescriptor, v any) {
+	obj, ok := v.(map[string]any)
+	if !ok || isWellKnown(desc) {
+		return
+	}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		val, ok := obj[fd.JSONName()]
+		if !ok {
+			continue
+		}
+		if l.isRedacted(fd) {
+			obj[fd.JSONName()] = redacted
+			continue
+		}
+		m := fieldMessage(fd)
+		if m == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if entries, ok := val.(map[string]any); ok {
+				for _, e := range entries {
+					l.redactValue(m, e)
+				}
+			}
+		case fd.IsList():
+			if items, ok := val.([]any); ok {
+				for _, e := range items {
+					l.redactValue(m, e)
+				}
+			}
+		default:
+			l.redactValue(m, val)
+		}
+	}
+}
+
+// fieldMessage 字段(或 map 值)的消息类型 非消息字段返回 nil
+func fieldMessage(fd protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if fd.IsMap() {
+		fd = fd.MapValue()
+	}
+	if fd.Kind() != protoreflect.MessageKind && fd.Kind() != protoreflect.GroupKind {
+		return nil
+	}
+	return fd.Message()
+}
+
+// isWellKnown google.protobuf 下的类型 JSON 编码不是普通对象
+func isWellKnown(desc protoreflect.MessageDescriptor) bool {
+	return strings.HasPrefix(string(desc.FullName()), "google.protobuf.")
+}
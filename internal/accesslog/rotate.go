@@ -0,0 +1,105 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// rotateTimeFormat 轮转文件名后缀 按时间排序即按轮转先后排序
+const rotateTimeFormat = "20060102-150405.000"
+
+// rotatingFile 按大小轮转的日志文件 当前文件写满后重命名为 <path>.<时间> 并新建文件
+// 由 Logger 加锁调用
+type rotatingFile struct {
+	path       string
+	maxSize    int64 // 为 0 时不轮转
+	maxBackups int   // 为 0 时保留全部轮转文件
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open 以追加方式打开当前文件
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		// 上次轮转失败 重新打开当前文件
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate %s: %w", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate 重命名当前文件并新建文件 清理超出保留数的旧文件
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Rename(f.path, f.path+"."+time.Now().Format(rotateTimeFormat)); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune 删除最旧的轮转文件
+func (f *rotatingFile) prune() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+	sort.Strings(backups)
+	for _, b := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(b)
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
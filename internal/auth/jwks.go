@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	// fileCheckInterval 两次检查 JWKS 文件变化的最小间隔
+	fileCheckInterval = time.Second
+	// missRefreshInterval 遇到未知 kid 时两次按需拉取 JWKS 的最小间隔 防止伪造 kid 放大请求
+	missRefreshInterval = 10 * time.Second
+	// fetchTimeout 拉取远程 JWKS 的超时
+	fetchTimeout = 5 * time.Second
+	// maxJWKSBytes 远程 JWKS 响应体上限
+	maxJWKSBytes = 1 << 20
+)
+
+// keySet 签名公钥集合 文件来源在使用时检查修改时间 URL 来源定期拉取且遇到未知 kid 时按需拉取
+// 加载失败时沿用旧公钥
+type keySet struct {
+	file     string
+	url      string
+	interval time.Duration
+	client   *http.Client
+
+	mu        sync.RWMutex
+	keys      []jose.JSONWebKey
+	modTime   time.Time // 文件修改时间
+	lastCheck time.Time // 上次检查文件或拉取 URL 的时间
+
+	refreshMu sync.Mutex // 同一时刻只拉取一次
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func newKeySet(conf Config) (*keySet, error) {
+	s := &keySet{
+		file:     conf.JWKSFile,
+		url:      conf.JWKSURL,
+		interval: conf.RefreshInterval,
+		client:   &http.Client{Timeout: fetchTimeout},
+	}
+	if s.file != "" {
+		if err := s.loadFile(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	// 远程 JWKS 暂不可用时不阻止网关启动 后续定期及按需重试
+	if err := s.fetch(); err != nil {
+		log.Printf("Warning: failed to fetch JWKS from %s, will retry: %v", s.url, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.run(ctx)
+	return s, nil
+}
+
+// run 定期拉取远程 JWKS
+func (s *keySet) run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshMu.Lock()
+			if err := s.fetch(); err != nil {
+				log.Printf("Warning: failed to refresh JWKS from %s, keeping previous keys: %v", s.url, err)
+			}
+			s.refreshMu.Unlock()
+		}
+	}
+}
+
+// close 停止定期拉取
+func (s *keySet) close() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// lookup 查找可校验令牌的公钥 kid 为空时返回全部与算法兼容的公钥
+// 未找到 kid 对应的公钥时 视为密钥轮换重新加载一次
+func (s *keySet) lookup(kid string, alg string) []jose.JSONWebKey {
+	if s.file != "" {
+		s.checkFile()
+	}
+	keys := s.match(kid, alg)
+	if len(keys) > 0 || kid == "" || s.url == "" {
+		return keys
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	// 等待期间其他请求可能已完成拉取
+	if keys = s.match(kid, alg); len(keys) > 0 {
+		return keys
+	}
+	s.mu.RLock()
+	recent := time.Since(s.lastCheck) < missRefreshInterval
+	s.mu.RUnlock()
+	if recent {
+		return nil
+	}
+	if err := s.fetch(); err != nil {
+		log.Printf("Warning: failed to refresh JWKS from %s for unknown kid %q: %v", s.url, kid, err)
+		return nil
+	}
+	return s.match(kid, alg)
+}
+
+func (s *keySet) match(kid string, alg string) []jose.JSONWebKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []jose.JSONWebKey
+	for _, k := range s.keys {
+		if kid != "" && k.KeyID != kid {
+			continue
+		}
+		if k.Algorithm != "" && k.Algorithm != alg {
+			continue
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// checkFile 文件变化时重新加载
+func (s *keySet) checkFile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastCheck) < fileCheckInterval {
+		return
+	}
+	s.lastCheck = now
+	info, err := os.Stat(s.file)
+	if err != nil || info.ModTime().Equal(s.modTime) {
+		return
+	}
+	keys, err := readKeyFile(s.file)
+	if err != nil {
+		log.Printf("Warning: failed to reload JWKS from %s, keeping previous keys: %v", s.file, err)
+		s.modTime = info.ModTime()
+		return
+	}
+	s.keys, s.modTime = keys, info.ModTime()
+	log.Printf("Reloaded JWKS from %s (%d keys)", s.file, len(keys))
+}
+
+// loadFile 首次加载 JWKS 文件
+func (s *keySet) loadFile() error {
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, err := readKeyFile(s.file)
+	if err != nil {
+		return err
+	}
+	s.keys, s.modTime, s.lastCheck = keys, info.ModTime(), time.Now()
+	return nil
+}
+
+func readKeyFile(name string) ([]jose.JSONWebKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	return parseKeySet(data, name)
+}
+
+// fetch 拉取远程 JWKS 调用方需持有 refreshMu
+func (s *keySet) fetch() error {
+	s.mu.Lock()
+	s.lastCheck = time.Now()
+	s.mu.Unlock()
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS response: %w", err)
+	}
+	keys, err := parseKeySet(data, s.url)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// parseKeySet 解析 JWKS 仅保留用于签名的非对称公钥 无法解析的公钥忽略并告警
+func parseKeySet(data []byte, source string) ([]jose.JSONWebKey, error) {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS from %s: %w", source, err)
+	}
+	keys := make([]jose.JSONWebKey, 0, len(set.Keys))
+	for i, raw := range set.Keys {
+		var k jose.JSONWebKey
+		if err := k.UnmarshalJSON(raw); err != nil {
+			log.Printf("Warning: skipped JWKS key #%d from %s: %v", i, source, err)
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// 私钥仅使用其公钥部分 对称密钥不受支持
+		pub := k.Public()
+		if !pub.Valid() {
+			log.Printf("Warning: skipped JWKS key %q from %s: not an asymmetric key", k.KeyID, source)
+			continue
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys in JWKS from %s", source)
+	}
+	return keys, nil
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// ClaimHeaderPrefix 已验证声明转发时使用的请求头前缀 随请求转发为 gRPC metadata x-jwt-claim-<声明名>
+const ClaimHeaderPrefix = "X-Jwt-Claim-"
+
+// ErrMissingToken 请求未携带 Bearer 令牌
+var ErrMissingToken = errors.New("missing bearer token")
+
+// supportedAlgorithms 支持的签名算法 仅非对称算法
+var supportedAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// Config JWT 认证配置
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// JWKSFile 本地 JWKS 文件 文件变化后自动重新加载 与 JWKSURL 二选一
+	JWKSFile string `mapstructure:"jwks_file"`
+	// JWKSURL 远程 JWKS 地址 定期拉取 遇到未知 kid 时按需拉取
+	JWKSURL string `mapstructure:"jwks_url"`
+	// RefreshInterval 远程 JWKS 的拉取间隔
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// Issuers 允许的签发者(iss) 为空时不校验
+	Issuers []string `mapstructure:"issuers"`
+	// Audiences 允许的受众(aud) 令牌受众与其有交集即可 为空时不校验
+	Audiences []string `mapstructure:"audiences"`
+	// Algorithms 允许的签名算法 为空时允许全部支持的算法(RS/PS/ES/EdDSA)
+	Algorithms []string `mapstructure:"algorithms"`
+	// ClockSkew 校验 exp/nbf/iat 时允许的时钟偏差
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+	// ForwardClaims 转发给上游的声明 写入 gRPC metadata x-jwt-claim-<声明名>
+	ForwardClaims []string `mapstructure:"forward_claims"`
+	// ForwardToken 是否继续转发原始 Authorization 请求头
+	ForwardToken bool `mapstructure:"forward_token"`
+}
+
+// DefaultConfig 默认认证配置 默认关闭
+func DefaultConfig() Config {
+	return Config{
+		RefreshInterval: 5 * time.Minute,
+		ClockSkew:       30 * time.Second,
+		ForwardClaims:   []string{"sub", "iss", "aud", "scope"},
+		ForwardToken:    true,
+	}
+}
+
+// Verifier 校验 JWT 签名与声明
+type Verifier struct {
+	keys          *keySet
+	algorithms    []jose.SignatureAlgorithm
+	issuers       []string
+	audiences     jwt.Audience
+	clockSkew     time.Duration
+	forwardClaims []string
+	forwardToken  bool
+}
+
+// NewVerifier 加载 JWKS 并创建校验器
+func NewVerifier(conf Config) (*Verifier, error) {
+	if (conf.JWKSFile == "") == (conf.JWKSURL == "") {
+		return nil, fmt.Errorf("exactly one of jwks_file and jwks_url is required")
+	}
+	if conf.JWKSURL != "" && conf.RefreshInterval <= 0 {
+		return nil, fmt.Errorf("refresh_interval must be positive")
+	}
+
+	algorithms := supportedAlgorithms
+	if len(conf.Algorithms) > 0 {
+		algorithms = make([]jose.SignatureAlgorithm, 0, len(conf.Algorithms))
+		for _, name := range conf.Algorithms {
+			alg := jose.SignatureAlgorithm(strings.TrimSpace(name))
+			if !slices.Contains(supportedAlgorithms, alg) {
+				return nil, fmt.Errorf("unsupported algorithm %q, expected one of RS256/384/512, PS256/384/512, ES256/384/512 or EdDSA", name)
+			}
+			algorithms = append(algorithms, alg)
+		}
+	}
+
+	keys, err := newKeySet(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		keys:          keys,
+		algorithms:    algorithms,
+		issuers:       conf.Issuers,
+		audiences:     jwt.Audience(conf.Audiences),
+		clockSkew:     conf.ClockSkew,
+		forwardClaims: conf.ForwardClaims,
+		forwardToken:  conf.ForwardToken,
+	}, nil
+}
+
+// Close 停止远程 JWKS 的定期拉取
+func (v *Verifier) Close() {
+	v.keys.close()
+}
+
+// Verify 校验令牌签名、签发者、受众与有效期 返回全部声明
+func (v *Verifier) Verify(token string) (map[string]any, error) {
+	tok, err := jwt.ParseSigned(token, v.algorithms)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if len(tok.Headers) != 1 {
+		return nil, fmt.Errorf("malformed token: expected exactly one signature")
+	}
+	header := tok.Headers[0]
+
+	keys := v.keys.lookup(header.KeyID, header.Algorithm)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing key found for kid %q", header.KeyID)
+	}
+	var (
+		claims jwt.Claims
+		raw    map[string]any
+	)
+	for _, k := range keys {
+		if err = tok.Claims(k.Key, &claims, &raw); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("token has no exp claim")
+	}
+	if len(v.issuers) > 0 && !slices.Contains(v.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("issuer %q is not allowed", claims.Issuer)
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{AnyAudience: v.audiences}, v.clockSkew); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Authenticate 校验请求携带的 Bearer 令牌 并将转发的声明写入请求头 返回全部声明 未携带令牌时为 nil
+// 调用方伪造的声明请求头总是被清除 required 为 false 时允许不携带令牌 但携带的令牌仍需有效
+func (v *Verifier) Authenticate(req *http.Request, required bool) (map[string]any, error) {
+	StripClaimHeaders(req.Header)
+
+	token, ok := bearerToken(req)
+	if !ok {
+		if required {
+			return nil, ErrMissingToken
+		}
+		return nil, nil
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range v.forwardClaims {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+		key := ClaimHeaderPrefix + claimKey(name)
+		if values, isList := value.([]any); isList {
+			for _, item := range values {
+				req.Header.Add(key, claimValue(item))
+			}
+			continue
+		}
+		req.Header.Set(key, claimValue(value))
+	}
+	if !v.forwardToken {
+		req.Header.Del("Authorization")
+	}
+	return claims, nil
+}
+
+// StripClaimHeaders 清除调用方伪造的声明请求头 未开启认证时同样需要调用 以免上游误信未经校验的声明
+func StripClaimHeaders(h http.Header) {
+	for k := range h {
+		if strings.HasPrefix(k, ClaimHeaderPrefix) {
+			h.Del(k)
+		}
+	}
+}
+
+// bearerToken 读取 Authorization: Bearer <token>
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(req.Header.Get("Authorization")), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// claimKey 将声明名转为合法的 metadata 键 非法字符替换为 -
+func claimKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, name)
+}
+
+// claimValue 声明值的字符串形式 字符串原样输出 数字不使用科学计数法 其余按 JSON 输出
+func claimValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
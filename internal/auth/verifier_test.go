@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// testKeys 测试用签名密钥 k1 为 ES256 k2 为 EdDSA 均写入本地 JWKS other 不在 JWKS 中
+type testKeys struct {
+	k1    *ecdsa.PrivateKey
+	k2    ed25519.PrivateKey
+	other *ecdsa.PrivateKey
+	jwks  string // JWKS 文件路径
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	k1, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pub2, k2, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	set := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &k1.PublicKey, KeyID: "k1", Use: "sig"},
+		{Key: pub2, KeyID: "k2", Use: "sig"},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal JWKS: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+	return &testKeys{k1: k1, k2: k2, other: other, jwks: path}
+}
+
+// sign 以 kid 对应的密钥签发令牌
+func (k *testKeys) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	key := jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: k.k1, KeyID: kid}}
+	switch kid {
+	case "k2":
+		key = jose.SigningKey{Algorithm: jose.EdDSA, Key: jose.JSONWebKey{Key: k.k2, KeyID: kid}}
+	case "forged":
+		// 使用 JWKS 之外的密钥冒用 k1
+		key = jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: k.other, KeyID: "k1"}}
+	}
+	return signWith(t, key, claims)
+}
+
+func signWith(t *testing.T, key jose.SigningKey, claims map[string]any) string {
+	t.Helper()
+	signer, err := jose.NewSigner(key, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func newTestVerifier(t *testing.T, keys *testKeys, modify func(*Config)) *Verifier {
+	t.Helper()
+	conf := DefaultConfig()
+	conf.Enabled = true
+	conf.JWKSFile = keys.jwks
+	conf.Issuers = []string{"https://issuer.example"}
+	conf.Audiences = []string{"pilot"}
+	conf.ClockSkew = 30 * time.Second
+	if modify != nil {
+		modify(&conf)
+	}
+	v, err := NewVerifier(conf)
+	if err != nil {
+		t.Fatalf("NewVerifier() error = %v", err)
+	}
+	t.Cleanup(v.Close)
+	return v
+}
+
+// validClaims 有效的声明 with 中的声明覆盖默认值 值为 nil 时删除该声明
+func validClaims(with map[string]any) map[string]any {
+	now := time.Now()
+	claims := map[string]any{
+		"sub": "u1",
+		"iss": "https://issuer.example",
+		"aud": "pilot",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	}
+	for k, v := range with {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		kid     string
+		claims  map[string]any
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{name: "valid", kid: "k1", claims: validClaims(nil)},
+		{name: "valid eddsa", kid: "k2", claims: validClaims(nil)},
+		{
+			name:    "disallowed alg",
+			kid:     "k2",
+			claims:  validClaims(nil),
+			modify:  func(c *Config) { c.Algorithms = []string{"ES256"} },
+			wantErr: true,
+		},
+		{name: "missing exp", kid: "k1", claims: validClaims(map[string]any{"exp": nil}), wantErr: true},
+		{name: "expired within skew", kid: "k1", claims: validClaims(map[string]any{"exp": now.Add(-10 * time.Second).Unix()})},
+		{name: "expired beyond skew", kid: "k1", claims: validClaims(map[string]any{"exp": now.Add(-time.Minute).Unix()}), wantErr: true},
+		{name: "not yet valid within skew", kid: "k1", claims: validClaims(map[string]any{"nbf": now.Add(10 * time.Second).Unix()})},
+		{name: "not yet valid beyond skew", kid: "k1", claims: validClaims(map[string]any{"nbf": now.Add(time.Minute).Unix()}), wantErr: true},
+		{name: "issuer mismatch", kid: "k1", claims: validClaims(map[string]any{"iss": "https://evil.example"}), wantErr: true},
+		{name: "audience mismatch", kid: "k1", claims: validClaims(map[string]any{"aud": "other"}), wantErr: true},
+		{name: "audience in list", kid: "k1", claims: validClaims(map[string]any{"aud": []string{"other", "pilot"}})},
+		{name: "missing audience", kid: "k1", claims: validClaims(map[string]any{"aud": nil}), wantErr: true},
+		{name: "unknown kid", kid: "k3", claims: validClaims(nil), wantErr: true},
+		{name: "signed by unknown key", kid: "forged", claims: validClaims(nil), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, keys, tt.modify)
+			claims, err := v.Verify(keys.sign(t, tt.kid, tt.claims))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && claims["sub"] != "u1" {
+				t.Errorf("Verify() sub = %v, want u1", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsSymmetricAlgorithm(t *testing.T) {
+	keys := newTestKeys(t)
+	v := newTestVerifier(t, keys, nil)
+	token := signWith(t, jose.SigningKey{Algorithm: jose.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}, validClaims(nil))
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("Verify() accepted an HS256 token")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	valid := keys.sign(t, "k1", validClaims(map[string]any{"scope": []string{"read", "write"}}))
+	expired := keys.sign(t, "k1", validClaims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}))
+
+	tests := []struct {
+		name          string
+		authorization string
+		required      bool
+		wantErr       error // 非 nil 时要求 errors.Is 匹配
+		wantFail      bool
+		wantClaims    bool
+	}{
+		{name: "valid token", authorization: "Bearer " + valid, required: true, wantClaims: true},
+		{name: "missing token required", required: true, wantErr: ErrMissingToken, wantFail: true},
+		{name: "missing token optional"},
+		{name: "non bearer scheme optional", authorization: "Basic dTE6cA=="},
+		{name: "invalid token optional", authorization: "Bearer " + expired, wantFail: true},
+		{name: "malformed token optional", authorization: "Bearer not-a-jwt", wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVerifier(t, keys, nil)
+			req := httptest.NewRequest("GET", "/v1/users/1", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			req.Header.Set("X-Jwt-Claim-Sub", "admin")
+			req.Header.Set("X-Jwt-Claim-Role", "admin")
+
+			claims, err := v.Authenticate(req, tt.required)
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("Authenticate() error = %v, wantFail %v", err, tt.wantFail)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if (claims != nil) != tt.wantClaims {
+				t.Fatalf("Authenticate() claims = %v, wantClaims %v", claims, tt.wantClaims)
+			}
+
+			// 伪造的声明请求头总是被清除 仅保留校验通过后写入的声明
+			if got := req.Header.Values("X-Jwt-Claim-Role"); len(got) != 0 {
+				t.Errorf("spoofed X-Jwt-Claim-Role = %v, want stripped", got)
+			}
+			wantSub := []string(nil)
+			if tt.wantClaims {
+				wantSub = []string{"u1"}
+			}
+			if got := req.Header.Values("X-Jwt-Claim-Sub"); !slices.Equal(got, wantSub) {
+				t.Errorf("X-Jwt-Claim-Sub = %v, want %v", got, wantSub)
+			}
+		})
+	}
+}
+
+func TestAuthenticateForwarding(t *testing.T) {
+	keys := newTestKeys(t)
+	v := newTestVerifier(t, keys, func(c *Config) { c.ForwardToken = false })
+	token := keys.sign(t, "k1", validClaims(map[string]any{"scope": []string{"read", "write"}, "iat": nil}))
+
+	req := httptest.NewRequest("GET", "/v1/users/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := v.Authenticate(req, true); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want removed when forward_token is false", got)
+	}
+	if got := req.Header.Values("X-Jwt-Claim-Scope"); !slices.Equal(got, []string{"read", "write"}) {
+		t.Errorf("X-Jwt-Claim-Scope = %v, want [read write]", got)
+	}
+	if got := req.Header.Get("X-Jwt-Claim-Iss"); got != "https://issuer.example" {
+		t.Errorf("X-Jwt-Claim-Iss = %q, want issuer", got)
+	}
+}
@@ -35,4 +35,21 @@ const (
 	EventAdd EventType = iota
 	EventDelete
 	EventUpdate
+	// EventSynced 初次加载的服务事件已全部发出 不携带服务信息
+	EventSynced
 )
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdd:
+		return "add"
+	case EventDelete:
+		return "delete"
+	case EventUpdate:
+		return "update"
+	case EventSynced:
+		return "synced"
+	default:
+		return "unknown"
+	}
+}
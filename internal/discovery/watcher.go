@@ -1,15 +1,21 @@
 package discovery
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"pilot/internal/metrics"
+
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
@@ -31,6 +37,9 @@ type Watcher struct {
 	instancesMap    map[string][]*ServiceInstance
 	initialLoading  bool
 
+	// disconnected 与 etcd 的连接断开的起始时间(UnixNano) 连接正常时为 0
+	disconnected atomic.Int64
+
 	mu sync.RWMutex
 }
 
@@ -43,6 +52,9 @@ func NewWatcher(endpoints []string, dialTimeout time.Duration, serviceMetadataPr
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:   endpoints,
 		DialTimeout: dialTimeout,
+		// 定期探测连接 以便在网络分区时及时发现连接断开
+		DialKeepAliveTime:    10 * time.Second,
+		DialKeepAliveTimeout: DefaultTimeout,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create etcd client: %w", err)
@@ -67,19 +79,23 @@ func NewWatcher(endpoints []string, dialTimeout time.Duration, serviceMetadataPr
 // Start 开始监听 etcd 中的服务变更
 func (w *Watcher) Start() error {
 	// First, load existing services and instances
-	if err := w.loadExistingServicesAndInstances(); err != nil {
+	metadataRev, instancesRev, err := w.loadExistingServicesAndInstances()
+	if err != nil {
 		return fmt.Errorf("failed to load existing services: %w", err)
 	}
+	// 初次加载的事件已全部发出 处理到该事件时路由已包含初次加载的全部服务
+	w.eventChan <- &ServiceEvent{Type: EventSynced}
 
-	// Start watching both paths
-	go w.watchMetadata()
-	go w.watchInstances()
+	// Start watching both paths 从加载时的版本之后开始监听 以免遗漏期间的变更
+	go w.watchMetadata(metadataRev)
+	go w.watchInstances(instancesRev)
+	go w.monitorConnection()
 
 	return nil
 }
 
-// loadExistingServicesAndInstances 从 etcd 加载所有现有的服务和实例
-func (w *Watcher) loadExistingServicesAndInstances() error {
+// loadExistingServicesAndInstances 从 etcd 加载所有现有的服务和实例 返回元数据与实例读取时的版本
+func (w *Watcher) loadExistingServicesAndInstances() (int64, int64, error) {
 	ctx, cancel := context.WithTimeout(w.ctx, DefaultTimeout)
 	defer cancel()
 
@@ -91,8 +107,9 @@ func (w *Watcher) loadExistingServicesAndInstances() error {
 	// Load service metadata from w.serviceMetadataPrefix
 	resp, err := w.client.Get(ctx, w.serviceMetadataPrefix, clientv3.WithPrefix())
 	if err != nil {
-		return fmt.Errorf("failed to get service metadata: %w", err)
+		return 0, 0, fmt.Errorf("failed to get service metadata: %w", err)
 	}
+	metadataRev := resp.Header.Revision
 
 	for _, kv := range resp.Kvs {
 		w.handleMetadataEvent(&clientv3.Event{
@@ -104,8 +121,9 @@ func (w *Watcher) loadExistingServicesAndInstances() error {
 	// 在 w.serviceDiscoveryPrefix 中加载所有实例
 	resp, err = w.client.Get(ctx, w.serviceDiscoveryPrefix, clientv3.WithPrefix())
 	if err != nil {
-		return fmt.Errorf("failed to get service instances: %w", err)
+		return 0, 0, fmt.Errorf("failed to get service instances: %w", err)
 	}
+	instancesRev := resp.Header.Revision
 
 	for _, kv := range resp.Kvs {
 		w.handleInstanceEvent(&clientv3.Event{
@@ -134,25 +152,34 @@ func (w *Watcher) loadExistingServicesAndInstances() error {
 			Instances:       instances,
 		}
 
-		w.eventChan <- &ServiceEvent{
+		w.emit(&ServiceEvent{
 			Type:    EventAdd,
 			Service: serviceInfo,
-		}
+		})
 	}
 
-	return nil
+	return metadataRev, instancesRev, nil
 }
 
 // watchMetadata 监听 w.serviceMetadataPrefix 路径下的服务元数据变更
-func (w *Watcher) watchMetadata() {
-	watchChan := w.client.Watch(w.ctx, w.serviceMetadataPrefix, clientv3.WithPrefix())
+func (w *Watcher) watchMetadata(rev int64) {
+	watchChan := w.client.Watch(w.ctx, w.serviceMetadataPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
 
 	for {
 		select {
 		case <-w.ctx.Done():
 			return
-		case watchResp := <-watchChan:
+		case watchResp, ok := <-watchChan:
+			// watch 通道关闭(如历史版本被压缩)时重新全量读取并对比本地状态 再从读取时的版本之后重新建立
+			if !ok {
+				if watchChan, ok = w.rewatch("metadata", w.serviceMetadataPrefix, w.resyncMetadata); !ok {
+					return
+				}
+				continue
+			}
+			// 历史版本被压缩时 watch 通道随后关闭 由重新读取补齐遗漏的变更
 			if watchResp.Err() != nil {
+				metrics.DiscoveryWatchErrors.WithLabelValues("metadata").Inc()
 				log.Printf("Metadata watch error: %v", watchResp.Err())
 				continue
 			}
@@ -165,15 +192,24 @@ func (w *Watcher) watchMetadata() {
 }
 
 // watchInstances 监听 w.serviceDiscoveryPrefix 路径下的服务实例变更
-func (w *Watcher) watchInstances() {
-	watchChan := w.client.Watch(w.ctx, w.serviceDiscoveryPrefix, clientv3.WithPrefix())
+func (w *Watcher) watchInstances(rev int64) {
+	watchChan := w.client.Watch(w.ctx, w.serviceDiscoveryPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
 
 	for {
 		select {
 		case <-w.ctx.Done():
 			return
-		case watchResp := <-watchChan:
+		case watchResp, ok := <-watchChan:
+			// watch 通道关闭(如历史版本被压缩)时重新全量读取并对比本地状态 再从读取时的版本之后重新建立
+			if !ok {
+				if watchChan, ok = w.rewatch("instances", w.serviceDiscoveryPrefix, w.resyncInstances); !ok {
+					return
+				}
+				continue
+			}
+			// 历史版本被压缩时 watch 通道随后关闭 由重新读取补齐遗漏的变更
 			if watchResp.Err() != nil {
+				metrics.DiscoveryWatchErrors.WithLabelValues("instances").Inc()
 				log.Printf("Instance watch error: %v", watchResp.Err())
 				continue
 			}
@@ -200,6 +236,7 @@ func (w *Watcher) handleMetadataEvent(event *clientv3.Event) {
 	case clientv3.EventTypePut:
 		metadata, err := w.parseServiceMetadata(event.Kv.Value)
 		if err != nil {
+			metrics.DiscoveryParseFailures.WithLabelValues("metadata").Inc()
 			log.Printf("Failed to parse service metadata for %s: %v", serviceName, err)
 			return
 		}
@@ -220,10 +257,10 @@ func (w *Watcher) handleMetadataEvent(event *clientv3.Event) {
 		if w.initialLoading {
 			return
 		}
-		w.eventChan <- &ServiceEvent{
+		w.emit(&ServiceEvent{
 			Type:    EventUpdate,
 			Service: serviceInfo,
-		}
+		})
 
 	case clientv3.EventTypeDelete:
 		metadata, exists := w.metadataMap[serviceName]
@@ -240,10 +277,10 @@ func (w *Watcher) handleMetadataEvent(event *clientv3.Event) {
 				ServiceMetadata: metadata,
 				Instances:       instances,
 			}
-			w.eventChan <- &ServiceEvent{
+			w.emit(&ServiceEvent{
 				Type:    EventDelete,
 				Service: serviceInfo,
-			}
+			})
 		}
 	}
 }
@@ -300,10 +337,10 @@ func (w *Watcher) handleInstanceEvent(event *clientv3.Event) {
 		if w.initialLoading {
 			return
 		}
-		w.eventChan <- &ServiceEvent{
+		w.emit(&ServiceEvent{
 			Type:    EventUpdate,
 			Service: serviceInfo,
-		}
+		})
 
 	case clientv3.EventTypeDelete:
 		instances := w.instancesMap[serviceName]
@@ -343,10 +380,10 @@ func (w *Watcher) handleInstanceEvent(event *clientv3.Event) {
 				Instances:       newInstances,
 			}
 
-			w.eventChan <- &ServiceEvent{
+			w.emit(&ServiceEvent{
 				Type:    EventDelete,
 				Service: serviceInfo,
-			}
+			})
 		} else {
 			serviceInfo := &ServiceInfo{
 				ServiceMetadata: metadata,
@@ -357,12 +394,176 @@ func (w *Watcher) handleInstanceEvent(event *clientv3.Event) {
 			if w.initialLoading {
 				return
 			}
-			w.eventChan <- &ServiceEvent{
+			w.emit(&ServiceEvent{
 				Type:    EventUpdate,
 				Service: serviceInfo,
+			})
+		}
+	}
+}
+
+// rewatch 等待后重新全量读取 prefix 下的键并发出与本地状态的差异事件 再从读取时的版本之后重新建立 watch
+// 读取失败时等待后重试 监听器已停止时返回 false
+func (w *Watcher) rewatch(kind, prefix string, resync func() (int64, error)) (clientv3.WatchChan, bool) {
+	for w.waitRestart() {
+		metrics.DiscoveryWatchRestarts.WithLabelValues(kind).Inc()
+		log.Printf("Warning: %s watch closed, resyncing", kind)
+		rev, err := resync()
+		if err != nil {
+			log.Printf("Failed to resync %s: %v", kind, err)
+			continue
+		}
+		return w.client.Watch(w.ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)), true
+	}
+	return nil, false
+}
+
+// resyncMetadata 重新读取全部服务元数据 新增、变更与删除的服务分别发出 add / update / delete 事件 返回读取时的版本
+func (w *Watcher) resyncMetadata() (int64, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, DefaultTimeout)
+	defer cancel()
+
+	resp, err := w.client.Get(ctx, w.serviceMetadataPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service metadata: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		serviceName := w.extractServiceNameFromMetadata(string(kv.Key))
+		if serviceName == "" {
+			continue
+		}
+		metadata, err := w.parseServiceMetadata(kv.Value)
+		if err != nil {
+			metrics.DiscoveryParseFailures.WithLabelValues("metadata").Inc()
+			log.Printf("Failed to parse service metadata for %s: %v", serviceName, err)
+			// 解析失败时保留原有元数据 与 watch 事件的处理一致
+			if _, exists := w.metadataMap[serviceName]; exists {
+				seen[serviceName] = true
 			}
+			continue
+		}
+		seen[serviceName] = true
+
+		old, exists := w.metadataMap[serviceName]
+		if exists && sameMetadata(old, metadata) {
+			continue
 		}
+		w.metadataMap[serviceName] = metadata
+
+		instances := w.instancesMap[serviceName]
+		if instances == nil {
+			instances = make([]*ServiceInstance, 0)
+		}
+		eventType := EventUpdate
+		if !exists {
+			eventType = EventAdd
+		}
+		w.emit(&ServiceEvent{
+			Type:    eventType,
+			Service: &ServiceInfo{ServiceMetadata: metadata, Instances: instances},
+		})
 	}
+
+	for serviceName, metadata := range w.metadataMap {
+		if seen[serviceName] {
+			continue
+		}
+		delete(w.metadataMap, serviceName)
+
+		// 与删除事件的处理一致 仍有实例时不发出删除事件
+		instances := w.instancesMap[serviceName]
+		if len(instances) == 0 {
+			w.emit(&ServiceEvent{
+				Type:    EventDelete,
+				Service: &ServiceInfo{ServiceMetadata: metadata, Instances: instances},
+			})
+		}
+	}
+
+	return resp.Header.Revision, nil
+}
+
+// resyncInstances 重新读取全部服务实例 实例变更的服务发出 update 事件 实例全部下线的服务发出 delete 事件 返回读取时的版本
+func (w *Watcher) resyncInstances() (int64, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, DefaultTimeout)
+	defer cancel()
+
+	resp, err := w.client.Get(ctx, w.serviceDiscoveryPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get service instances: %w", err)
+	}
+
+	latest := make(map[string][]*ServiceInstance)
+	for _, kv := range resp.Kvs {
+		serviceName := w.extractServiceNameFromInstance(string(kv.Key))
+		if serviceName == "" {
+			continue
+		}
+		if instance := w.parseServiceInstance(string(kv.Value)); instance != nil {
+			latest[serviceName] = append(latest[serviceName], instance)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for serviceName := range w.instancesMap {
+		if _, ok := latest[serviceName]; !ok {
+			latest[serviceName] = make([]*ServiceInstance, 0)
+		}
+	}
+
+	for serviceName, instances := range latest {
+		if sameInstances(w.instancesMap[serviceName], instances) {
+			continue
+		}
+		w.instancesMap[serviceName] = instances
+
+		metadata := w.metadataMap[serviceName]
+		if metadata == nil {
+			continue
+		}
+		eventType := EventUpdate
+		if len(instances) == 0 {
+			eventType = EventDelete
+		}
+		w.emit(&ServiceEvent{
+			Type:    eventType,
+			Service: &ServiceInfo{ServiceMetadata: metadata, Instances: instances},
+		})
+	}
+
+	return resp.Header.Revision, nil
+}
+
+// sameMetadata 两份服务元数据内容是否相同
+func sameMetadata(a, b *ServiceMetadata) bool {
+	return a.ServiceName == b.ServiceName &&
+		a.Version == b.Version &&
+		bytes.Equal(a.DescriptorData, b.DescriptorData) &&
+		maps.Equal(a.Metadata, b.Metadata)
+}
+
+// sameInstances 两组实例的地址是否相同 不考虑顺序
+func sameInstances(a, b []*ServiceInstance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	addrs := make(map[string]bool, len(a))
+	for _, inst := range a {
+		addrs[inst.Addr] = true
+	}
+	for _, inst := range b {
+		if !addrs[inst.Addr] {
+			return false
+		}
+	}
+	return true
 }
 
 // parseServiceMetadata 解析服务元数据，从 /w.serviceMetadataPrefix/{service_name} 中解析服务元数据
@@ -389,6 +590,7 @@ func (w *Watcher) parseServiceInstance(value string) *ServiceInstance {
 	// Format: "host:port"
 	parts := strings.Split(value, ":")
 	if len(parts) != 2 {
+		metrics.DiscoveryParseFailures.WithLabelValues("instance").Inc()
 		log.Printf("Invalid service instance value format: %s", value)
 		return nil
 	}
@@ -396,6 +598,7 @@ func (w *Watcher) parseServiceInstance(value string) *ServiceInstance {
 	address := parts[0]
 	var port int
 	if _, err := fmt.Sscanf(parts[1], "%d", &port); err != nil {
+		metrics.DiscoveryParseFailures.WithLabelValues("instance").Inc()
 		log.Printf("Invalid port in service instance: %s", value)
 		return nil
 	}
@@ -435,6 +638,55 @@ func (w *Watcher) extractServiceNameFromInstance(key string) string {
 	return ""
 }
 
+// emit 发出服务事件
+func (w *Watcher) emit(event *ServiceEvent) {
+	metrics.DiscoveryEvents.WithLabelValues(event.Type.String()).Inc()
+	w.eventChan <- event
+}
+
+// watchRestartDelay watch 通道关闭后重新建立前的等待时间
+const watchRestartDelay = time.Second
+
+// waitRestart 等待重新建立 watch 监听器已停止时返回 false
+func (w *Watcher) waitRestart() bool {
+	select {
+	case <-w.ctx.Done():
+		return false
+	case <-time.After(watchRestartDelay):
+		return true
+	}
+}
+
+// monitorConnection 跟踪与 etcd 的连接状态 连接中断或重连中时记录断开的起始时间
+// watch 始终保持活动的流 连接不会因空闲进入 IDLE 因此仅 READY 视为连接正常
+func (w *Watcher) monitorConnection() {
+	conn := w.client.ActiveConnection()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			if w.disconnected.Swap(0) != 0 {
+				log.Printf("Reconnected to etcd")
+			}
+		default:
+			if w.disconnected.CompareAndSwap(0, time.Now().UnixNano()) {
+				log.Printf("Warning: lost connection to etcd (%s)", state)
+			}
+		}
+		if !conn.WaitForStateChange(w.ctx, state) {
+			return
+		}
+	}
+}
+
+// DisconnectedSince 与 etcd 的连接断开的起始时间 连接正常时返回零值
+func (w *Watcher) DisconnectedSince() time.Time {
+	if since := w.disconnected.Load(); since != 0 {
+		return time.Unix(0, since)
+	}
+	return time.Time{}
+}
+
 // Events 返回用于接收服务事件的通道
 func (w *Watcher) Events() <-chan *ServiceEvent {
 	return w.eventChan
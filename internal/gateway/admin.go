@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pilot/internal/metrics"
+	"pilot/internal/router"
+
+	"github.com/bytedance/sonic"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AdminConfig 管理端口配置 与业务流量分开监听 不经过 TLS、认证与限流
+type AdminConfig struct {
+	// Addr 监听地址 为空时不开启
+	Addr string `mapstructure:"addr"`
+}
+
+// newAdminServer 创建管理端口服务
+// /metrics 输出 Prometheus 指标
+// /healthz、/readyz 为存活与就绪检查 未就绪时返回 503 与原因
+// /routes、/services、/routes/match 以统一响应格式输出路由表、服务实例与路由匹配测试结果
+func newAdminServer(conf AdminConfig, r *router.HTTPRouter, ready *readiness) *http.Server {
+	reg := metrics.NewRegistry(newRouterCollector(r))
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		writeAdminJSON(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, req *http.Request) {
+		if err := ready.check(); err != nil {
+			writeAdminJSON(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("GET /routes", func(w http.ResponseWriter, req *http.Request) {
+		writeAdminJSON(w, http.StatusOK, r.Routes(req.URL.Query().Get("service")))
+	})
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, req *http.Request) {
+		writeAdminJSON(w, http.StatusOK, r.Services())
+	})
+	mux.HandleFunc("GET /routes/match", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		method := q.Get("method")
+		if method == "" {
+			method = http.MethodGet
+		}
+		websocket, _ := strconv.ParseBool(q.Get("websocket"))
+		res, err := r.Match(method, q.Get("path"), websocket)
+		if err != nil {
+			writeAdminJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, res)
+	})
+	return &http.Server{
+		Addr:              conf.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+}
+
+// writeAdminJSON 以统一响应格式输出 data 为 error 时输出错误信息
+func writeAdminJSON(w http.ResponseWriter, status int, data any) {
+	res := router.Result{Code: 0, Msg: "success", Data: data}
+	if err, ok := data.(error); ok {
+		res = router.Result{Code: status, Msg: err.Error(), Data: nil}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := sonic.ConfigDefault.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("Failed to encode admin response: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// HealthConfig 存活与就绪检查配置 检查接口由管理端口提供
+type HealthConfig struct {
+	// EtcdGracePeriod 与 etcd 的连接断开超过该时间后不再就绪 为 0 时连接断开即不就绪
+	EtcdGracePeriod time.Duration `mapstructure:"etcd_grace_period"`
+	// DrainDelay 停机时标记为未就绪后等待该时间再关闭监听器 以便负载均衡摘除本实例
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+}
+
+// readiness 就绪状态
+// 初次加载的服务全部注册到路由器后就绪 etcd 连接断开超过宽限期或开始停机后不再就绪
+type readiness struct {
+	synced       atomic.Bool
+	stopping     atomic.Bool
+	grace        time.Duration
+	disconnected func() time.Time // 与 etcd 的连接断开的起始时间 连接正常时为零值
+}
+
+// check 就绪时返回 nil 否则返回原因
+func (r *readiness) check() error {
+	if r.stopping.Load() {
+		return fmt.Errorf("gateway is shutting down")
+	}
+	if !r.synced.Load() {
+		return fmt.Errorf("initial service discovery load has not been applied")
+	}
+	if since := r.disconnected(); !since.IsZero() {
+		if lost := time.Since(since); lost > r.grace {
+			return fmt.Errorf("etcd connection lost for %s", lost.Round(time.Second))
+		}
+	}
+	return nil
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"pilot/internal/accesslog"
+	"pilot/internal/auth"
 	"pilot/internal/discovery"
-	"strings"
 
 	"pilot/internal/router"
+	"pilot/internal/tracing"
 	"time"
 )
 
@@ -18,6 +20,9 @@ type HTTPConfig struct {
 	WriteTimeout   time.Duration `mapstructure:"write_timeout"`
 	MaxHeaderBytes int           `mapstructure:"max_header_bytes"`
 	MaxBodyBytes   int           `mapstructure:"max_body_bytes"`
+	TLS            TLSConfig     `mapstructure:"tls"`
+	// H2C 是否接受明文 HTTP/2(prior knowledge) 用于内部部署
+	H2C bool `mapstructure:"h2c"`
 }
 
 type EtcdConfig struct {
@@ -28,51 +33,16 @@ type EtcdConfig struct {
 }
 
 type Config struct {
-	HTTP HTTPConfig `mapstructure:"http"`
-	Etcd EtcdConfig `mapstructure:"etcd"`
-}
-
-// crosMiddleware 跨域支持
-func crosMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Vary", "Origin")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
-		} else {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		}
-
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-
-		reqHeaders := r.Header.Get("Access-Control-Request-Headers")
-		if reqHeaders == "" {
-			reqHeaders = "Content-Type,Authorization,X-Requested-With,X-Csrf-Token"
-		}
-		// 规范空白与大小写
-		reqHeaders = strings.Join(func(items []string) []string {
-			out := make([]string, 0, len(items))
-			for _, h := range items {
-				h = strings.TrimSpace(h)
-				if h != "" {
-					out = append(out, h)
-				}
-			}
-			return out
-		}(strings.Split(reqHeaders, ",")), ",")
-		w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
-
-		// 缓存预检结果减少预检请求次数
-		w.Header().Set("Access-Control-Max-Age", "600")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+	HTTP      HTTPConfig                   `mapstructure:"http"`
+	Etcd      EtcdConfig                   `mapstructure:"etcd"`
+	Upstream  router.Config                `mapstructure:"upstream"`
+	CORS      router.CORSConfig            `mapstructure:"cors"`
+	Auth      auth.Config                  `mapstructure:"auth"`
+	RateLimit router.GlobalRateLimitConfig `mapstructure:"rate_limit"`
+	Admin     AdminConfig                  `mapstructure:"admin"`
+	Tracing   tracing.Config               `mapstructure:"tracing"`
+	AccessLog accesslog.Config             `mapstructure:"access_log"`
+	Health    HealthConfig                 `mapstructure:"health"`
 }
 
 // bodyLimitMiddleware 限制请求体大小
@@ -101,14 +71,26 @@ func DefaultConfig() *Config {
 			ServiceMetadataPrefix: "/services/",
 			ServerDiscoveryPrefix: "/discovery/",
 		},
+		Upstream:  router.DefaultConfig(),
+		CORS:      router.DefaultCORSConfig(),
+		Auth:      auth.DefaultConfig(),
+		Admin:     AdminConfig{Addr: ":9090"},
+		Tracing:   tracing.DefaultConfig(),
+		AccessLog: accesslog.DefaultConfig(),
+		Health:    HealthConfig{EtcdGracePeriod: 30 * time.Second, DrainDelay: 5 * time.Second},
 	}
 }
 
 type HTTPGateway struct {
 	config  *Config
 	router  *router.HTTPRouter
+	auth    *auth.Verifier
 	watcher *discovery.Watcher
 	server  *http.Server
+	admin   *http.Server                // 管理端口 未开启时为 nil
+	tracing func(context.Context) error // 刷新并关闭追踪导出器 未开启时为 nil
+	access  *accesslog.Logger           // 访问日志 未开启时为 nil
+	ready   *readiness
 	ctx     context.Context
 	cancel  context.CancelFunc
 }
@@ -120,18 +102,72 @@ func NewHTTPGateway(config *Config) (*HTTPGateway, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
+	// 初始化失败时释放已创建的资源
+	var (
+		verifier        *auth.Verifier
+		accessLog       *accesslog.Logger
+		watcher         *discovery.Watcher
+		shutdownTracing func(context.Context) error
+		success         bool
+	)
+	defer func() {
+		if success {
+			return
+		}
+		cancel()
+		if verifier != nil {
+			verifier.Close()
+		}
+		if accessLog != nil {
+			accessLog.Close()
+		}
+		if watcher != nil {
+			watcher.Stop()
+		}
+		if shutdownTracing != nil {
+			shutdownTracing(context.Background())
+		}
+	}()
+
+	// 未配置上游默认超时时沿用写超时 超过写超时的上游超时会使响应在上游返回前被截断
+	upstream := config.Upstream
+	if upstream.Timeout.Default <= 0 {
+		upstream.Timeout.Default = config.HTTP.WriteTimeout
+	}
+	if wt := config.HTTP.WriteTimeout; wt > 0 && max(upstream.Timeout.Default, upstream.Timeout.Max) > wt {
+		log.Printf("Warning: upstream timeout (default %s, max %s) exceeds http.write_timeout %s, slow responses will be cut off", upstream.Timeout.Default, upstream.Timeout.Max, wt)
+	}
+
+	// JWT 认证
+	if config.Auth.Enabled {
+		v, err := auth.NewVerifier(config.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create JWT verifier: %w", err)
+		}
+		verifier = v
+	}
+
+	// 访问日志
+	if config.AccessLog.Enabled {
+		l, err := accesslog.New(config.AccessLog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create access log: %w", err)
+		}
+		accessLog = l
+	}
+
 	// 创建路由树
-	r := router.NewHTTPRouter()
+	r := router.NewHTTPRouter(upstream, config.CORS, verifier, config.RateLimit, accessLog)
 
 	// 创建etcd watcher
-	watcher, err := discovery.NewWatcher(
+	var err error
+	watcher, err = discovery.NewWatcher(
 		config.Etcd.Endpoints,
 		config.Etcd.DialTimeout,
 		config.Etcd.ServiceMetadataPrefix,
 		config.Etcd.ServerDiscoveryPrefix,
 	)
 	if err != nil {
-		cancel()
 		return nil, fmt.Errorf("failed to create watcher: %w", err)
 	}
 
@@ -142,7 +178,7 @@ func NewHTTPGateway(config *Config) (*HTTPGateway, error) {
 
 	var handler http.Handler = mux
 	handler = bodyLimitMiddleware(handler, config.HTTP.MaxBodyBytes)
-	handler = crosMiddleware(handler)
+	handler = clientCertMiddleware(handler)
 
 	server := &http.Server{
 		Addr:           config.HTTP.Addr,
@@ -151,41 +187,96 @@ func NewHTTPGateway(config *Config) (*HTTPGateway, error) {
 		WriteTimeout:   config.HTTP.WriteTimeout,
 		MaxHeaderBytes: config.HTTP.MaxHeaderBytes,
 	}
+	// TLS 终止 HTTP/2 经 ALPN 协商
+	if config.HTTP.TLS.Enabled {
+		certs, err := newCertReloader(config.HTTP.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: %w", err)
+		}
+		server.TLSConfig = certs.tlsConfig()
+	}
+	if config.HTTP.H2C {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// 链路追踪
+	if config.Tracing.Enabled {
+		shutdown, err := tracing.Setup(config.Tracing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		shutdownTracing = shutdown
+	}
 
 	g := &HTTPGateway{
 		config:  config,
 		router:  r,
+		auth:    verifier,
 		watcher: watcher,
 		server:  server,
+		tracing: shutdownTracing,
+		access:  accessLog,
 		ctx:     ctx,
 		cancel:  cancel,
 	}
+	g.ready = &readiness{grace: config.Health.EtcdGracePeriod, disconnected: watcher.DisconnectedSince}
+	if config.Admin.Addr != "" {
+		g.admin = newAdminServer(config.Admin, r, g.ready)
+	}
 
+	success = true
 	return g, nil
 }
 
 // Start 启动 HTTP 网关
 func (g *HTTPGateway) Start() error {
+	// 开启协程处理事件 须先于监听器启动 以免初次加载的服务数超过事件通道容量时阻塞
+	go g.processEvents()
+
 	// 启动etcd监听器
 	if err := g.watcher.Start(); err != nil {
 		return fmt.Errorf("failed to start watcher: %w", err)
 	}
 
-	// 开启协程处理事件
-	go g.processEvents()
-
 	// 开启http服务
-	log.Printf("Starting HTTP gateway on %s", g.config.HTTP.Addr)
+	scheme := "HTTP"
+	if g.server.TLSConfig != nil {
+		scheme = "HTTPS"
+	}
+	log.Printf("Starting %s gateway on %s (h2c: %t)", scheme, g.config.HTTP.Addr, g.config.HTTP.H2C)
 	log.Printf("Watching etcd endpoints: %v", g.config.Etcd.Endpoints)
 	log.Printf("Service metadata path: %s", g.config.Etcd.ServiceMetadataPrefix)
 	log.Printf("Service discovery path: %s", g.config.Etcd.ServerDiscoveryPrefix)
+	if g.tracing != nil {
+		log.Printf("Exporting traces via %s", g.config.Tracing.Exporter)
+	}
 
 	go func() {
-		if err := g.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if g.server.TLSConfig != nil {
+			// 证书由 TLSConfig 动态提供
+			err = g.server.ListenAndServeTLS("", "")
+		} else {
+			err = g.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
 
+	// 开启管理端口
+	if g.admin != nil {
+		log.Printf("Starting admin server on %s", g.config.Admin.Addr)
+		go func() {
+			if err := g.admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start admin server: %v", err)
+			}
+		}()
+	}
+
 	return nil
 }
 
@@ -195,7 +286,10 @@ func (g *HTTPGateway) processEvents() {
 		select {
 		case <-g.ctx.Done():
 			return
-		case event := <-g.watcher.Events():
+		case event, ok := <-g.watcher.Events():
+			if !ok {
+				return
+			}
 			g.handleEvent(event)
 		}
 	}
@@ -219,6 +313,10 @@ func (g *HTTPGateway) handleEvent(event *discovery.ServiceEvent) {
 		if err := g.router.UnRegisterService(event.Service); err != nil {
 			log.Printf("Failed to unregister service %s: %v", event.Service.ServiceName, err)
 		}
+
+	case discovery.EventSynced:
+		g.ready.synced.Store(true)
+		log.Printf("Initial service discovery load applied, gateway is ready")
 	}
 }
 
@@ -226,6 +324,13 @@ func (g *HTTPGateway) handleEvent(event *discovery.ServiceEvent) {
 func (g *HTTPGateway) Stop() error {
 	log.Println("Stopping HTTP gateway...")
 
+	// 标记为未就绪 等待负载均衡摘除本实例后再关闭监听器
+	g.ready.stopping.Store(true)
+	if g.admin != nil && g.config.Health.DrainDelay > 0 {
+		log.Printf("Draining for %s before shutdown", g.config.Health.DrainDelay)
+		time.Sleep(g.config.Health.DrainDelay)
+	}
+
 	// 停止处理事件
 	g.cancel()
 
@@ -236,6 +341,18 @@ func (g *HTTPGateway) Stop() error {
 	if err := g.server.Shutdown(ctx); err != nil {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	if g.admin != nil {
+		if err := g.admin.Shutdown(ctx); err != nil {
+			log.Printf("Admin server shutdown error: %v", err)
+		}
+	}
+
+	// 导出剩余的 span
+	if g.tracing != nil {
+		if err := g.tracing(ctx); err != nil {
+			log.Printf("Tracing shutdown error: %v", err)
+		}
+	}
 
 	// 停止etcd监听器
 	if err := g.watcher.Stop(); err != nil {
@@ -244,6 +361,14 @@ func (g *HTTPGateway) Stop() error {
 
 	// 关闭路由器
 	g.router.Close()
+	if g.auth != nil {
+		g.auth.Close()
+	}
+	if g.access != nil {
+		if err := g.access.Close(); err != nil {
+			log.Printf("Access log close error: %v", err)
+		}
+	}
 
 	log.Println("HTTP gateway stopped")
 	return nil
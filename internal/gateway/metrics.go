@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"pilot/internal/router"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// routerCollector 抓取时读取路由器的路由数与实例状态
+type routerCollector struct {
+	router    *router.HTTPRouter
+	routes    *prometheus.Desc
+	instances *prometheus.Desc
+	inFlight  *prometheus.Desc
+}
+
+func newRouterCollector(r *router.HTTPRouter) *routerCollector {
+	return &routerCollector{
+		router: r,
+		routes: prometheus.NewDesc("pilot_routes",
+			"Routes registered in the route tree.", []string{"service"}, nil),
+		instances: prometheus.NewDesc("pilot_upstream_instances",
+			"Upstream instances held by each service pool, by state (healthy, unhealthy, ejected).", []string{"service", "state"}, nil),
+		inFlight: prometheus.NewDesc("pilot_upstream_in_flight",
+			"Calls in flight to each upstream instance.", []string{"service", "instance"}, nil),
+	}
+}
+
+func (c *routerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.routes
+	ch <- c.instances
+	ch <- c.inFlight
+}
+
+func (c *routerCollector) Collect(ch chan<- prometheus.Metric) {
+	for service, n := range c.router.RouteCounts() {
+		ch <- prometheus.MustNewConstMetric(c.routes, prometheus.GaugeValue, float64(n), service)
+	}
+	for service, instances := range c.router.Instances() {
+		states := map[string]int{"healthy": 0, "unhealthy": 0, "ejected": 0}
+		for _, inst := range instances {
+			switch {
+			case inst.Ejected:
+				states["ejected"]++
+			case !inst.Healthy:
+				states["unhealthy"]++
+			default:
+				states["healthy"]++
+			}
+			ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(inst.Outstanding), service, inst.Addr)
+		}
+		for state, n := range states {
+			ch <- prometheus.MustNewConstMetric(c.instances, prometheus.GaugeValue, float64(n), service, state)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval 两次检查证书文件变化的最小间隔
+const certReloadInterval = time.Second
+
+// clientCertSubjectHeader 已验证客户端证书的主题 随请求转发为 gRPC metadata x-client-cert-subject
+const clientCertSubjectHeader = "X-Client-Cert-Subject"
+
+// TLSConfig 网关监听器的 TLS 配置
+type TLSConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Certificates 服务端证书 按 SNI 选择 无匹配时使用第一个
+	Certificates []CertificateConfig `mapstructure:"certificates"`
+	// ClientCAFile 校验客户端证书的 CA 包
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ClientAuth 客户端证书校验方式 none | verify_if_given | require 未配置时有 CA 为 require 否则为 none
+	ClientAuth string `mapstructure:"client_auth"`
+	// MinVersion 最低 TLS 版本 1.2 | 1.3
+	MinVersion string `mapstructure:"min_version"`
+}
+
+// CertificateConfig 证书与私钥文件
+type CertificateConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// certReloader 握手时检查证书文件是否变化 变化后新连接使用新证书 加载失败时沿用旧证书
+type certReloader struct {
+	conf       TLSConfig
+	clientAuth tls.ClientAuthType
+	minVersion uint16
+
+	mu        sync.Mutex
+	certs     []tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(conf TLSConfig) (*certReloader, error) {
+	if len(conf.Certificates) == 0 {
+		return nil, fmt.Errorf("at least one certificate is required")
+	}
+	c := &certReloader{conf: conf}
+
+	switch conf.MinVersion {
+	case "", "1.2":
+		c.minVersion = tls.VersionTLS12
+	case "1.3":
+		c.minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported min_version %q, expected 1.2 or 1.3", conf.MinVersion)
+	}
+
+	switch conf.ClientAuth {
+	case "":
+		c.clientAuth = tls.NoClientCert
+		if conf.ClientCAFile != "" {
+			c.clientAuth = tls.RequireAndVerifyClientCert
+		}
+	case "none":
+		c.clientAuth = tls.NoClientCert
+	case "verify_if_given":
+		c.clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		c.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported client_auth %q, expected none, verify_if_given or require", conf.ClientAuth)
+	}
+	if c.clientAuth != tls.NoClientCert && conf.ClientCAFile == "" {
+		return nil, fmt.Errorf("client_auth %q requires client_ca_file", conf.ClientAuth)
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// files 需要监听变化的文件
+func (c *certReloader) files() []string {
+	files := make([]string, 0, len(c.conf.Certificates)*2+1)
+	for _, cert := range c.conf.Certificates {
+		files = append(files, cert.CertFile, cert.KeyFile)
+	}
+	if c.conf.ClientCAFile != "" {
+		files = append(files, c.conf.ClientCAFile)
+	}
+	return files
+}
+
+// stat 获取文件修改时间 无法访问的文件为零值
+func (c *certReloader) stat() []time.Time {
+	files := c.files()
+	out := make([]time.Time, len(files))
+	for i, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			out[i] = info.ModTime()
+		}
+	}
+	return out
+}
+
+// load 读取全部证书文件
+func (c *certReloader) load() error {
+	certs := make([]tls.Certificate, 0, len(c.conf.Certificates))
+	for _, conf := range c.conf.Certificates {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", conf.CertFile, err)
+		}
+		certs = append(certs, cert)
+	}
+	var clientCAs *x509.CertPool
+	if c.conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.conf.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", c.conf.ClientCAFile)
+		}
+	}
+
+	c.certs, c.clientCAs = certs, clientCAs
+	c.modTimes = c.stat()
+	c.lastCheck = time.Now()
+	return nil
+}
+
+// tlsConfig 监听器使用的 TLS 配置 每次握手通过 GetConfigForClient 取当前证书
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         c.minVersion,
+		GetConfigForClient: c.configForClient,
+	}
+}
+
+func (c *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastCheck) >= certReloadInterval {
+		c.lastCheck = now
+		if modTimes := c.stat(); !equalTimes(modTimes, c.modTimes) {
+			if err := c.load(); err != nil {
+				log.Printf("Warning: failed to reload gateway TLS certificates, keeping previous ones: %v", err)
+				c.modTimes = modTimes
+			} else {
+				log.Printf("Reloaded gateway TLS certificates")
+			}
+		}
+	}
+
+	// 标准库按 SNI 在 Certificates 中选择证书 无匹配时使用第一个
+	return &tls.Config{
+		MinVersion:   c.minVersion,
+		Certificates: c.certs,
+		ClientAuth:   c.clientAuth,
+		ClientCAs:    c.clientCAs,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientCertMiddleware 将已验证客户端证书的主题写入请求头 并清除调用方伪造的同名请求头
+func clientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(clientCertSubjectHeader)
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r.Header.Set(clientCertSubjectHeader, r.TLS.VerifiedChains[0][0].Subject.String())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
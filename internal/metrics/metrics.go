@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "pilot"
+
+var (
+	// HTTPRequests 网关处理的 HTTP 请求数
+	// route 为路由模板(如 GET /v1/users/{id}) 未匹配路由时 route/service/method 为空
+	// grpc_code 为上游调用的 gRPC 状态码 未调用上游时为空
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled by the gateway.",
+	}, []string{"route", "service", "method", "status", "grpc_code"})
+
+	// HTTPRequestDuration 请求处理耗时 流式调用为整个流的持续时间
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency in seconds, streams are measured until they end.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "service", "method", "status", "grpc_code"})
+
+	// UpstreamRequests 对上游实例的调用次数 含重试与对冲
+	UpstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Calls sent to upstream instances, including retries and hedges.",
+	}, []string{"service", "instance"})
+
+	// UpstreamErrors 上游实例返回错误的调用次数
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Upstream calls that failed, by gRPC code.",
+	}, []string{"service", "instance", "grpc_code"})
+
+	// DiscoveryEvents 服务发现发出的事件数 type 为 add / update / delete
+	DiscoveryEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discovery_events_total",
+		Help:      "Service events emitted by the etcd watcher.",
+	}, []string{"type"})
+
+	// DiscoveryWatchRestarts etcd watch 中断后重新建立的次数 prefix 为 metadata / instances
+	DiscoveryWatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discovery_watch_restarts_total",
+		Help:      "Times an etcd watch was re-established after it was closed.",
+	}, []string{"prefix"})
+
+	// DiscoveryWatchErrors etcd watch 返回的错误数
+	DiscoveryWatchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discovery_watch_errors_total",
+		Help:      "Errors returned by etcd watches.",
+	}, []string{"prefix"})
+
+	// DiscoveryParseFailures 无法解析的 etcd 值 kind 为 metadata / instance
+	DiscoveryParseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discovery_parse_failures_total",
+		Help:      "etcd values that could not be parsed.",
+	}, []string{"kind"})
+)
+
+// NewRegistry 创建包含网关全部指标与 Go 运行时、进程指标的注册表
+func NewRegistry(extra ...prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		UpstreamRequests,
+		UpstreamErrors,
+		DiscoveryEvents,
+		DiscoveryWatchRestarts,
+		DiscoveryWatchErrors,
+		DiscoveryParseFailures,
+	)
+	reg.MustRegister(extra...)
+	return reg
+}
+
+// RemoveUpstream 删除已下线实例的指标
+func RemoveUpstream(service, instance string) {
+	labels := prometheus.Labels{"service": service, "instance": instance}
+	UpstreamRequests.DeletePartialMatch(labels)
+	UpstreamErrors.DeletePartialMatch(labels)
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"pilot/internal/accesslog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader 请求 ID 请求头 随其他请求头转发为 gRPC metadata x-request-id 并在响应头返回
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen 调用方请求 ID 的最大长度
+const maxRequestIDLen = 128
+
+// requestID 沿用调用方的请求 ID 缺失或不合法时生成新的
+func requestID(w http.ResponseWriter, req *http.Request) string {
+	id := req.Header.Get(requestIDHeader)
+	if !validRequestID(id) {
+		var b [16]byte
+		rand.Read(b[:])
+		id = hex.EncodeToString(b[:])
+		req.Header.Set(requestIDHeader, id)
+	}
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// validRequestID 请求 ID 仅允许可打印 ASCII 字符 以免污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// countingBody 统计已读取的请求体字节数
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// logAccess 写出请求的访问日志
+func (r *HTTPRouter) logAccess(w *responseRecorder, req *http.Request, span trace.Span, id string, start time.Time, elapsed time.Duration, body *countingBody) {
+	code := w.status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	e := &accesslog.Entry{
+		Time:       start,
+		RequestID:  id,
+		ClientIP:   r.clientIP.resolve(req),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Upstream:   w.upstream,
+		Status:     code,
+		GRPCCode:   w.code,
+		DurationMS: float64(elapsed.Microseconds()) / 1000,
+		BytesOut:   w.bytes,
+		UserAgent:  req.UserAgent(),
+	}
+	if w.route != nil {
+		e.Route = routeTemplate(w.route)
+		e.Service = w.route.ServiceName
+		e.FullMethod = w.route.FullMethod
+	}
+	if body != nil {
+		e.BytesIn = body.n
+	}
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		e.TraceID = sc.TraceID().String()
+	}
+	if r.accessLog.CaptureBody() {
+		e.RequestBody = r.accessLog.Body(w.reqMsg, w.resolver)
+		e.ResponseBody = r.accessLog.Body(w.respMsg, w.resolver)
+	}
+	r.accessLog.Log(e)
+}
@@ -0,0 +1,367 @@
+package router
+
+import (
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"pilot/internal/transcoder"
+)
+
+// 负载均衡策略
+const (
+	PolicyRoundRobin         = "round_robin"
+	PolicyLeastRequest       = "least_request"
+	PolicyP2CEWMA            = "p2c_ewma"
+	PolicyWeightedRoundRobin = "weighted_round_robin"
+	PolicyConsistentHash     = "consistent_hash"
+)
+
+// ewmaDecay 延迟 EWMA 的衰减时间常数
+const ewmaDecay = 10 * time.Second
+
+// Upstream 服务实例及其调用统计
+type Upstream struct {
+	addr        string
+	invoker     *transcoder.GRPCInvoker
+	weight      int          // 由 pool.mu 保护
+	outstanding atomic.Int64 // 进行中的请求数
+	ewma        atomic.Uint64
+	lastSeen    atomic.Int64  // 最近一次延迟采样时间 纳秒
+	healthy     atomic.Bool   // 主动健康检查结果 未开启时始终为 true
+	stopHealth  chan struct{} // 由 pool.mu 保护
+
+	// 被动异常检测
+	consecutiveErrors atomic.Int64
+	successes         atomic.Int64 // 当前分析周期内的成功数
+	failures          atomic.Int64 // 当前分析周期内的失败数
+	ejectedUntil      atomic.Int64 // 驱逐截止时间 纳秒 0 表示未被驱逐
+	ejections         int          // 驱逐倍数 由 pool.mu 保护
+}
+
+func newUpstream(addr string, invoker *transcoder.GRPCInvoker) *Upstream {
+	u := &Upstream{addr: addr, invoker: invoker, weight: 1}
+	u.healthy.Store(true)
+	return u
+}
+
+// Addr 实例地址 host:port
+func (u *Upstream) Addr() string {
+	return u.addr
+}
+
+// Weight 实例权重
+func (u *Upstream) Weight() int {
+	return u.weight
+}
+
+// Outstanding 进行中的请求数
+func (u *Upstream) Outstanding() int64 {
+	return u.outstanding.Load()
+}
+
+// Healthy 实例是否通过健康检查
+func (u *Upstream) Healthy() bool {
+	return u.healthy.Load()
+}
+
+// Ejected 实例是否被异常检测驱逐
+func (u *Upstream) Ejected() bool {
+	return u.ejectedUntil.Load() != 0
+}
+
+// available 实例是否可被选择
+func (u *Upstream) available() bool {
+	return u.healthy.Load() && !u.Ejected()
+}
+
+// Latency 延迟的指数加权移动平均 尚无采样时为 0
+func (u *Upstream) Latency() time.Duration {
+	return time.Duration(math.Float64frombits(u.ewma.Load()))
+}
+
+// acquire 记录一次请求开始
+func (u *Upstream) acquire() {
+	u.outstanding.Add(1)
+}
+
+// release 记录一次请求结束
+func (u *Upstream) release() {
+	u.outstanding.Add(-1)
+}
+
+// observe 按采样间隔衰减更新延迟 EWMA
+func (u *Upstream) observe(rtt time.Duration) {
+	now := time.Now().UnixNano()
+	last := u.lastSeen.Swap(now)
+	prev := math.Float64frombits(u.ewma.Load())
+	next := float64(rtt)
+	if last > 0 && prev > 0 {
+		w := math.Exp(-float64(now-last) / float64(ewmaDecay))
+		next = prev*w + float64(rtt)*(1-w)
+	}
+	u.ewma.Store(math.Float64bits(next))
+}
+
+// Balancer 负载均衡器
+// Pick 在调用方持有服务池读锁时执行 实现需自行保证内部状态的并发安全
+type Balancer interface {
+	// Pick 从候选实例中选择一个 hashKey 仅一致性哈希策略使用 无可选实例时返回 nil
+	Pick(candidates []*Upstream, hashKey string) *Upstream
+	// Update 可选实例集合或权重变化时调用 用于重建内部状态 upstreams 为全部可选实例
+	Update(upstreams []*Upstream)
+}
+
+// newBalancer 按策略名创建负载均衡器 未知策略回退为轮询
+func newBalancer(serviceName, policy string) Balancer {
+	switch policy {
+	case "", PolicyRoundRobin:
+		return &roundRobinBalancer{}
+	case PolicyLeastRequest:
+		return &leastRequestBalancer{}
+	case PolicyP2CEWMA:
+		return &p2cBalancer{}
+	case PolicyWeightedRoundRobin:
+		return &weightedRoundRobinBalancer{current: make(map[*Upstream]int)}
+	case PolicyConsistentHash:
+		return &consistentHashBalancer{}
+	default:
+		log.Printf("Warning: unknown load balancing policy %q for service %s, using %s", policy, serviceName, PolicyRoundRobin)
+		return &roundRobinBalancer{}
+	}
+}
+
+// roundRobinBalancer 轮询
+type roundRobinBalancer struct {
+	counter atomic.Uint64
+}
+
+func (b *roundRobinBalancer) Pick(candidates []*Upstream, _ string) *Upstream {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[b.counter.Add(1)%uint64(len(candidates))]
+}
+
+func (b *roundRobinBalancer) Update([]*Upstream) {}
+
+// leastRequestBalancer 选择进行中请求数最少的实例 相同时从随机位置开始取第一个
+type leastRequestBalancer struct{}
+
+func (b *leastRequestBalancer) Pick(candidates []*Upstream, _ string) *Upstream {
+	n := len(candidates)
+	if n == 0 {
+		return nil
+	}
+	offset := rand.IntN(n)
+	var best *Upstream
+	for i := range n {
+		u := candidates[(offset+i)%n]
+		if best == nil || u.Outstanding() < best.Outstanding() {
+			best = u
+		}
+	}
+	return best
+}
+
+func (b *leastRequestBalancer) Update([]*Upstream) {}
+
+// p2cBalancer 随机选择两个实例 取 EWMA 延迟与进行中请求数综合代价较低者
+type p2cBalancer struct{}
+
+func (b *p2cBalancer) Pick(candidates []*Upstream, _ string) *Upstream {
+	n := len(candidates)
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+	i := rand.IntN(n)
+	j := rand.IntN(n - 1)
+	if j >= i {
+		j++
+	}
+	a, c := candidates[i], candidates[j]
+	if p2cCost(c) < p2cCost(a) {
+		return c
+	}
+	return a
+}
+
+func (b *p2cBalancer) Update([]*Upstream) {}
+
+// p2cCost 实例代价 尚无延迟采样的实例代价最低 便于新实例获得流量
+func p2cCost(u *Upstream) float64 {
+	return math.Float64frombits(u.ewma.Load()) * float64(u.Outstanding()+1)
+}
+
+// weightedRoundRobinBalancer 平滑加权轮询
+type weightedRoundRobinBalancer struct {
+	current map[*Upstream]int
+	mu      sync.Mutex
+}
+
+func (b *weightedRoundRobinBalancer) Pick(candidates []*Upstream, _ string) *Upstream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		best  *Upstream
+		total int
+	)
+	for _, u := range candidates {
+		b.current[u] += u.weight
+		total += u.weight
+		if best == nil || b.current[u] > b.current[best] {
+			best = u
+		}
+	}
+	if best != nil {
+		b.current[best] -= total
+	}
+	return best
+}
+
+func (b *weightedRoundRobinBalancer) Update(upstreams []*Upstream) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current = make(map[*Upstream]int, len(upstreams))
+}
+
+// consistentHashBalancer 一致性哈希 每个实例按权重放置虚拟节点
+// 哈希环仅包含可选实例 命中的实例不在候选集合中(如重试时排除)时沿哈希环顺延 hashKey 为空时退化为轮询
+type consistentHashBalancer struct {
+	ring     atomic.Pointer[hashRing]
+	fallback roundRobinBalancer
+}
+
+type hashRing struct {
+	hashes []uint64
+	nodes  []*Upstream
+	size   int // 环上的实例数
+}
+
+const (
+	hashReplicas    = 100  // 每单位权重的虚拟节点数
+	maxHashReplicas = 1000 // 单个实例的虚拟节点上限 超出时按权重比例缩减
+)
+
+func (b *consistentHashBalancer) Pick(candidates []*Upstream, hashKey string) *Upstream {
+	ring := b.ring.Load()
+	if hashKey == "" || ring == nil || len(ring.hashes) == 0 {
+		return b.fallback.Pick(candidates, hashKey)
+	}
+	h := hashString(hashKey)
+	start, _ := slices.BinarySearch(ring.hashes, h)
+	// 每个实例只检查一次 候选集合即全部可选实例时首个虚拟节点即命中
+	var seen map[*Upstream]struct{}
+	for i := range len(ring.hashes) {
+		u := ring.nodes[(start+i)%len(ring.hashes)]
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		if slices.Contains(candidates, u) {
+			return u
+		}
+		if seen == nil {
+			seen = make(map[*Upstream]struct{}, ring.size)
+		}
+		seen[u] = struct{}{}
+		if len(seen) == ring.size {
+			break
+		}
+	}
+	return b.fallback.Pick(candidates, hashKey)
+}
+
+func (b *consistentHashBalancer) Update(upstreams []*Upstream) {
+	type vnode struct {
+		hash uint64
+		node *Upstream
+	}
+	maxWeight := 1
+	for _, u := range upstreams {
+		maxWeight = max(maxWeight, u.weight)
+	}
+	vnodes := make([]vnode, 0, len(upstreams)*replicasFor(maxWeight, maxWeight))
+	for _, u := range upstreams {
+		for i := range replicasFor(u.weight, maxWeight) {
+			vnodes = append(vnodes, vnode{hash: hashString(u.addr + "#" + strconv.Itoa(i)), node: u})
+		}
+	}
+	slices.SortFunc(vnodes, func(a, b vnode) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return strings.Compare(a.node.addr, b.node.addr)
+	})
+	ring := &hashRing{
+		hashes: make([]uint64, len(vnodes)),
+		nodes:  make([]*Upstream, len(vnodes)),
+		size:   len(upstreams),
+	}
+	for i, v := range vnodes {
+		ring.hashes[i] = v.hash
+		ring.nodes[i] = v.node
+	}
+	b.ring.Store(ring)
+}
+
+// replicasFor 实例的虚拟节点数 最大权重超出上限时按比例缩减 每个实例至少一个
+func replicasFor(weight, maxWeight int) int {
+	if maxWeight <= maxHashReplicas/hashReplicas {
+		return hashReplicas * weight
+	}
+	return max(1, int(float64(weight)/float64(maxWeight)*maxHashReplicas))
+}
+
+// hashString FNV-1a 哈希 末尾做一次混合 避免相近的键落在哈希环的相邻位置
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// hashKeyFunc 按 hash_on 配置生成哈希键提取函数 配置为空或非法时返回 nil
+func hashKeyFunc(serviceName, hashOn string) func(req *http.Request, pathParams map[string]string) string {
+	if hashOn == "" {
+		return nil
+	}
+	source, name, ok := strings.Cut(hashOn, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		log.Printf("Warning: invalid hash_on %q for service %s, expected header:<name> or path:<field>", hashOn, serviceName)
+		return nil
+	}
+	switch strings.ToLower(strings.TrimSpace(source)) {
+	case "header":
+		return func(req *http.Request, _ map[string]string) string {
+			return req.Header.Get(name)
+		}
+	case "path":
+		return func(_ *http.Request, pathParams map[string]string) string {
+			return pathParams[name]
+		}
+	default:
+		log.Printf("Warning: invalid hash_on %q for service %s, expected header:<name> or path:<field>", hashOn, serviceName)
+		return nil
+	}
+}
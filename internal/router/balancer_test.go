@@ -0,0 +1,106 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func newTestUpstreams(n int) []*Upstream {
+	ups := make([]*Upstream, n)
+	for i := range ups {
+		ups[i] = newUpstream(fmt.Sprintf("10.0.0.%d:9000", i+1), nil)
+	}
+	return ups
+}
+
+func TestConsistentHashPick(t *testing.T) {
+	ups := newTestUpstreams(4)
+	b := &consistentHashBalancer{}
+	b.Update(ups)
+
+	// 相同键始终命中同一实例
+	picked := make(map[string]*Upstream)
+	for i := range 100 {
+		key := "user-" + strconv.Itoa(i)
+		u := b.Pick(ups, key)
+		if u == nil {
+			t.Fatalf("Pick(%q) = nil", key)
+		}
+		if again := b.Pick(ups, key); again != u {
+			t.Fatalf("Pick(%q) = %s then %s", key, u.addr, again.addr)
+		}
+		picked[key] = u
+	}
+
+	// 排除实例时 原本命中其他实例的键不受影响 命中被排除实例的键改投剩余实例
+	excluded := ups[1]
+	candidates := []*Upstream{ups[0], ups[2], ups[3]}
+	for key, u := range picked {
+		got := b.Pick(candidates, key)
+		switch {
+		case got == excluded:
+			t.Fatalf("Pick(%q) returned excluded instance %s", key, excluded.addr)
+		case u != excluded && got != u:
+			t.Errorf("Pick(%q) = %s, want %s", key, got.addr, u.addr)
+		}
+	}
+
+	// 实例不可选后以剩余实例重建哈希环 与排除时的选择一致
+	rebuilt := &consistentHashBalancer{}
+	rebuilt.Update(candidates)
+	for key := range picked {
+		if got, want := rebuilt.Pick(candidates, key), b.Pick(candidates, key); got != want {
+			t.Errorf("rebuilt Pick(%q) = %s, want %s", key, got.addr, want.addr)
+		}
+	}
+}
+
+func TestConsistentHashEmptyKeyFallsBack(t *testing.T) {
+	ups := newTestUpstreams(3)
+	b := &consistentHashBalancer{}
+	b.Update(ups)
+	seen := make(map[*Upstream]bool)
+	for range 3 {
+		seen[b.Pick(ups, "")] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("empty hash key picked %d distinct instances, want round robin over 3", len(seen))
+	}
+}
+
+func TestConsistentHashReplicas(t *testing.T) {
+	tests := []struct {
+		weights []int
+		want    []int
+	}{
+		{weights: []int{1, 1}, want: []int{100, 100}},
+		{weights: []int{1, 10}, want: []int{100, 1000}},
+		{weights: []int{1, 20}, want: []int{50, 1000}},
+		{weights: []int{1, 5000}, want: []int{1, 1000}},
+		{weights: []int{1 << 40, 1 << 41}, want: []int{500, 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.weights), func(t *testing.T) {
+			ups := newTestUpstreams(len(tt.weights))
+			for i, w := range tt.weights {
+				ups[i].weight = w
+			}
+			b := &consistentHashBalancer{}
+			b.Update(ups)
+			ring := b.ring.Load()
+			counts := make(map[*Upstream]int)
+			for _, u := range ring.nodes {
+				counts[u]++
+			}
+			for i, u := range ups {
+				if counts[u] != tt.want[i] {
+					t.Errorf("instance %d with weight %d has %d vnodes, want %d", i, tt.weights[i], counts[u], tt.want[i])
+				}
+			}
+			if ring.size != len(ups) {
+				t.Errorf("ring size = %d, want %d", ring.size, len(ups))
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// breakerBuckets 滑动窗口的分桶数
+const breakerBuckets = 10
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerBucket struct {
+	total    int
+	failures int
+	slow     int
+}
+
+// circuitBreaker 熔断器
+// closed: 统计滑动窗口内的错误率与慢调用率 超过阈值后打开
+// open: 请求快速失败 到期后进入 half-open
+// half-open: 放行有限的试探请求 全部成功后关闭 任一失败重新打开
+type circuitBreaker struct {
+	name string
+	conf BreakerConfig
+	now  func() time.Time // 时钟 默认 time.Now
+
+	mu          sync.Mutex
+	state       breakerState
+	generation  uint64 // 每次状态切换递增 丢弃切换前放行请求的结果
+	openUntil   time.Time
+	trials      int // half-open 已放行的试探请求数
+	successes   int // half-open 已成功的试探请求数
+	buckets     [breakerBuckets]breakerBucket
+	bucketIdx   int
+	bucketStart time.Time
+}
+
+func newCircuitBreaker(name string, conf BreakerConfig) *circuitBreaker {
+	conf.HalfOpenRequests = max(conf.HalfOpenRequests, 1)
+	conf.MinRequests = max(conf.MinRequests, 1)
+	return &circuitBreaker{name: name, conf: conf, now: time.Now}
+}
+
+// allow 判断请求是否放行 放行时返回结果记录所需的状态代数 拒绝时返回建议的重试等待时长
+// trial 为 false 的请求(如流式调用)在半开状态直接放行 不占用试探名额 也不参与统计
+func (b *circuitBreaker) allow(trial bool) (uint64, time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == breakerOpen {
+		if now.Before(b.openUntil) {
+			return 0, b.openUntil.Sub(now), false
+		}
+		b.state = breakerHalfOpen
+		b.generation++
+		b.trials, b.successes = 0, 0
+		log.Printf("Circuit breaker for %s is half-open", b.name)
+	}
+	if b.state == breakerHalfOpen && trial {
+		if b.trials >= b.conf.HalfOpenRequests {
+			return 0, time.Second, false
+		}
+		b.trials++
+	}
+	return b.generation, 0, true
+}
+
+// record 记录一次放行请求的结果 客户端取消的请求不计入
+func (b *circuitBreaker) record(generation uint64, err error, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	ignored := err != nil && (errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled)
+	failure := !ignored && isBreakerFailure(err)
+	slow := !ignored && b.conf.SlowCallDuration > 0 && latency >= b.conf.SlowCallDuration
+
+	switch b.state {
+	case breakerHalfOpen:
+		switch {
+		case ignored:
+			// 归还试探名额
+			b.trials--
+		case failure || slow:
+			b.trip(b.now(), "trial request failed")
+		default:
+			b.successes++
+			if b.successes >= b.conf.HalfOpenRequests {
+				b.state = breakerClosed
+				b.generation++
+				b.buckets = [breakerBuckets]breakerBucket{}
+				log.Printf("Circuit breaker for %s closed", b.name)
+			}
+		}
+	case breakerClosed:
+		if ignored {
+			return
+		}
+		now := b.now()
+		b.rotate(now)
+		bucket := &b.buckets[b.bucketIdx]
+		bucket.total++
+		if failure {
+			bucket.failures++
+		}
+		if slow {
+			bucket.slow++
+		}
+		b.evaluate(now)
+	}
+}
+
+// evaluate 按窗口统计判断是否打开熔断
+func (b *circuitBreaker) evaluate(now time.Time) {
+	var total, failures, slow int
+	for _, bucket := range b.buckets {
+		total += bucket.total
+		failures += bucket.failures
+		slow += bucket.slow
+	}
+	if total < b.conf.MinRequests {
+		return
+	}
+	errorRate := float64(failures) / float64(total)
+	slowRate := float64(slow) / float64(total)
+	switch {
+	case b.conf.ErrorRate > 0 && errorRate >= b.conf.ErrorRate:
+		b.trip(now, fmt.Sprintf("error rate %.2f over %d requests", errorRate, total))
+	case b.conf.SlowCallRate > 0 && slowRate >= b.conf.SlowCallRate:
+		b.trip(now, fmt.Sprintf("slow call rate %.2f over %d requests", slowRate, total))
+	}
+}
+
+// trip 打开熔断
+func (b *circuitBreaker) trip(now time.Time, reason string) {
+	b.state = breakerOpen
+	b.generation++
+	b.openUntil = now.Add(b.conf.OpenDuration)
+	b.buckets = [breakerBuckets]breakerBucket{}
+	log.Printf("Warning: circuit breaker for %s opened for %s: %s", b.name, b.conf.OpenDuration, reason)
+}
+
+// rotate 按时间推进滑动窗口 清空过期的桶
+func (b *circuitBreaker) rotate(now time.Time) {
+	width := b.conf.Window / breakerBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	if b.bucketStart.IsZero() {
+		b.bucketStart = now
+		return
+	}
+	steps := int(now.Sub(b.bucketStart) / width)
+	if steps <= 0 {
+		return
+	}
+	if steps >= breakerBuckets {
+		b.buckets = [breakerBuckets]breakerBucket{}
+		b.bucketIdx = 0
+		b.bucketStart = now
+		return
+	}
+	for range steps {
+		b.bucketIdx = (b.bucketIdx + 1) % breakerBuckets
+		b.buckets[b.bucketIdx] = breakerBucket{}
+	}
+	b.bucketStart = b.bucketStart.Add(time.Duration(steps) * width)
+}
+
+// isBreakerFailure 判断调用错误是否计入熔断错误率 业务错误(如 NotFound)不计入
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return isOutlierError(err) || status.Code(err) == codes.DeadlineExceeded
+}
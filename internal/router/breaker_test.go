@@ -0,0 +1,189 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+var (
+	errUnavailable = status.Error(codes.Unavailable, "unavailable")
+	errNotFound    = status.Error(codes.NotFound, "not found")
+)
+
+func newTestBreaker(clock *fakeClock) *circuitBreaker {
+	b := newCircuitBreaker("demo", BreakerConfig{
+		Window:           10 * time.Second,
+		MinRequests:      4,
+		ErrorRate:        0.5,
+		SlowCallDuration: time.Second,
+		SlowCallRate:     0.5,
+		OpenDuration:     5 * time.Second,
+		HalfOpenRequests: 2,
+	})
+	b.now = clock.Now
+	return b
+}
+
+// mustAllow 断言请求被放行 返回状态代数
+func mustAllow(t *testing.T, b *circuitBreaker, trial bool) uint64 {
+	t.Helper()
+	gen, retryAfter, ok := b.allow(trial)
+	if !ok {
+		t.Fatalf("allow(%v) rejected (state %d, retry after %s), want allowed", trial, b.state, retryAfter)
+	}
+	return gen
+}
+
+// mustReject 断言请求被拒绝 返回建议的重试等待时长
+func mustReject(t *testing.T, b *circuitBreaker, trial bool) time.Duration {
+	t.Helper()
+	_, retryAfter, ok := b.allow(trial)
+	if ok {
+		t.Fatalf("allow(%v) allowed (state %d), want rejected", trial, b.state)
+	}
+	return retryAfter
+}
+
+func assertState(t *testing.T, b *circuitBreaker, want breakerState) {
+	t.Helper()
+	if b.state != want {
+		t.Fatalf("state = %d, want %d", b.state, want)
+	}
+}
+
+func TestBreakerLifecycle(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBreaker(clock)
+
+	// closed: 未达到最小请求数时不熔断 业务错误不计入错误率
+	g0 := mustAllow(t, b, true)
+	b.record(g0, errUnavailable, time.Millisecond)
+	b.record(g0, errNotFound, time.Millisecond)
+	b.record(g0, nil, time.Millisecond)
+	assertState(t, b, breakerClosed)
+
+	// 第 4 个请求使错误率达到 0.5 熔断打开
+	stale := mustAllow(t, b, true)
+	b.record(stale, errUnavailable, time.Millisecond)
+	assertState(t, b, breakerOpen)
+	if b.generation == g0 {
+		t.Fatal("generation not advanced on open")
+	}
+
+	// open: 快速失败并返回剩余打开时长
+	if got := mustReject(t, b, true); got != 5*time.Second {
+		t.Fatalf("retry after = %s, want 5s", got)
+	}
+	clock.Advance(2 * time.Second)
+	if got := mustReject(t, b, false); got != 3*time.Second {
+		t.Fatalf("retry after = %s, want 3s", got)
+	}
+	// 打开前放行的请求结果被丢弃
+	b.record(stale, nil, time.Millisecond)
+	assertState(t, b, breakerOpen)
+
+	// half-open: 到期后放行有限的试探请求 非试探请求直接放行
+	clock.Advance(3 * time.Second)
+	g1 := mustAllow(t, b, true)
+	assertState(t, b, breakerHalfOpen)
+	mustAllow(t, b, true)
+	if got := mustReject(t, b, true); got != time.Second {
+		t.Fatalf("retry after = %s, want 1s", got)
+	}
+	mustAllow(t, b, false)
+
+	// 取消的试探请求归还名额
+	b.record(g1, context.Canceled, time.Millisecond)
+	b.record(g1, nil, time.Millisecond)
+	assertState(t, b, breakerHalfOpen)
+	mustAllow(t, b, true)
+	b.record(g1, nil, time.Millisecond)
+
+	// 全部试探成功后关闭 半开期间的迟到结果被丢弃
+	assertState(t, b, breakerClosed)
+	if b.generation == g1 {
+		t.Fatal("generation not advanced on close")
+	}
+	b.record(g1, errUnavailable, time.Millisecond)
+	assertState(t, b, breakerClosed)
+	for _, bucket := range b.buckets {
+		if bucket != (breakerBucket{}) {
+			t.Fatalf("window not reset on close: %+v", b.buckets)
+		}
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBreaker(clock)
+	b.trip(clock.Now(), "test")
+
+	clock.Advance(5 * time.Second)
+	g := mustAllow(t, b, true)
+	assertState(t, b, breakerHalfOpen)
+
+	// 慢调用同样视为试探失败
+	b.record(g, nil, 2*time.Second)
+	assertState(t, b, breakerOpen)
+	if got := mustReject(t, b, true); got != 5*time.Second {
+		t.Fatalf("retry after = %s, want 5s", got)
+	}
+	// 重新打开前放行的另一个试探请求结果被丢弃
+	b.record(g, nil, time.Millisecond)
+	assertState(t, b, breakerOpen)
+}
+
+func TestBreakerSlowCallRate(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBreaker(clock)
+	g := mustAllow(t, b, true)
+	for _, latency := range []time.Duration{time.Millisecond, time.Second, time.Millisecond, 3 * time.Second} {
+		b.record(g, nil, latency)
+	}
+	assertState(t, b, breakerOpen)
+}
+
+func TestBreakerWindowExpires(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBreaker(clock)
+	g := mustAllow(t, b, true)
+
+	// 窗口外的失败不再计入
+	b.record(g, errUnavailable, time.Millisecond)
+	b.record(g, errUnavailable, time.Millisecond)
+	b.record(g, errUnavailable, time.Millisecond)
+	clock.Advance(10 * time.Second)
+	b.record(g, errUnavailable, time.Millisecond)
+	b.record(g, nil, time.Millisecond)
+	b.record(g, nil, time.Millisecond)
+	b.record(g, nil, time.Millisecond)
+	assertState(t, b, breakerClosed)
+
+	// 仍在窗口内的请求与新的失败合并计算
+	clock.Advance(5 * time.Second)
+	b.record(g, errUnavailable, time.Millisecond)
+	b.record(g, errUnavailable, time.Millisecond)
+	b.record(g, errUnavailable, time.Millisecond)
+	assertState(t, b, breakerOpen)
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheHeader 响应头 HIT 表示响应来自网关缓存 MISS 表示已调用上游并写入缓存
+const cacheHeader = "X-Pilot-Cache"
+
+// cacheMaxEntries 每个服务缓存的响应数上限
+const cacheMaxEntries = 1024
+
+// cachePolicy 路由的响应缓存策略
+type cachePolicy struct {
+	ttl  time.Duration // 为 0 时不缓存
+	vary []string      // 参与缓存键的请求头
+}
+
+// newCachePolicy 由路由配置生成缓存策略 仅缓存 GET 一元调用
+func newCachePolicy(route *Route, conf CacheConfig) cachePolicy {
+	if conf.TTL <= 0 || route.HttpRule.Method != http.MethodGet ||
+		route.MethodDesc.IsClientStreaming() || route.MethodDesc.IsServerStreaming() {
+		return cachePolicy{}
+	}
+	policy := cachePolicy{ttl: conf.TTL}
+	for _, h := range conf.VaryHeaders {
+		if h = strings.TrimSpace(h); h != "" {
+			policy.vary = append(policy.vary, http.CanonicalHeaderKey(h))
+		}
+	}
+	return policy
+}
+
+// key 计算缓存键 请求不可缓存时返回 false 须在认证修改请求头之前调用
+// 携带凭证(Authorization、Cookie 或 credentials 中的 API Key 请求头)且其未参与缓存键时不缓存 避免不同用户共享响应
+func (p cachePolicy) key(route *Route, req *http.Request, credentials ...string) (string, bool) {
+	if p.ttl <= 0 {
+		return "", false
+	}
+	private := func(h string) bool {
+		return h != "" && req.Header.Get(h) != "" && !slices.Contains(p.vary, h)
+	}
+	if private("Authorization") || private("Cookie") || slices.ContainsFunc(credentials, private) {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(route.FullMethod)
+	b.WriteByte(0)
+	b.WriteString(req.URL.RequestURI())
+	for _, h := range p.vary {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(req.Header.Values(h), ","))
+	}
+	return b.String(), true
+}
+
+// cacheEntry 缓存的响应体
+type cacheEntry struct {
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache 服务的响应缓存
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func (c *responseCache) get(key string, now time.Time) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put 写入缓存 已满时先清理过期项 仍已满时随机淘汰一项
+func (c *responseCache) put(key string, body []byte, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= cacheMaxEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < cacheMaxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{body: body, stored: now, expires: now.Add(ttl)}
+}
+
+// clear 清空缓存
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// serveCached 输出缓存的响应 请求声明 Cache-Control: no-cache 时跳过缓存
+func (c *responseCache) serveCached(w http.ResponseWriter, req *http.Request, key string) bool {
+	if strings.Contains(strings.ToLower(req.Header.Get("Cache-Control")), "no-cache") {
+		return false
+	}
+	now := time.Now()
+	entry, ok := c.get(key, now)
+	if !ok {
+		return false
+	}
+	w.Header().Set(cacheHeader, "HIT")
+	w.Header().Set("Age", strconv.Itoa(int(now.Sub(entry.stored)/time.Second)))
+	writeBody(w, entry.body)
+	return true
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCachePolicyKey(t *testing.T) {
+	route := &Route{FullMethod: "/demo.v1.UserService/GetUser"}
+
+	tests := []struct {
+		name        string
+		vary        []string
+		headers     map[string]string
+		credentials []string
+		want        bool
+	}{
+		{name: "anonymous", want: true},
+		{name: "authorization", headers: map[string]string{"Authorization": "Bearer a"}, want: false},
+		{name: "authorization varied", vary: []string{"Authorization"}, headers: map[string]string{"Authorization": "Bearer a"}, want: true},
+		{name: "cookie", headers: map[string]string{"Cookie": "session=a"}, want: false},
+		{name: "cookie varied", vary: []string{"Cookie"}, headers: map[string]string{"Cookie": "session=a"}, want: true},
+		{name: "api key", headers: map[string]string{"X-Api-Key": "a"}, credentials: []string{"", "X-Api-Key"}, want: false},
+		{name: "api key varied", vary: []string{"X-Api-Key"}, headers: map[string]string{"X-Api-Key": "a"}, credentials: []string{"X-Api-Key", ""}, want: true},
+		{name: "api key not a rate limit key", headers: map[string]string{"X-Api-Key": "a"}, want: true},
+		{name: "api key absent", credentials: []string{"X-Api-Key"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := cachePolicy{ttl: time.Minute, vary: tt.vary}
+			req := httptest.NewRequest("GET", "/v1/users/1", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if _, got := policy.key(route, req, tt.credentials...); got != tt.want {
+				t.Fatalf("key() cacheable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachePolicyKeyVaries(t *testing.T) {
+	route := &Route{FullMethod: "/demo.v1.UserService/GetUser"}
+	policy := cachePolicy{ttl: time.Minute, vary: []string{"Authorization", "Cookie"}}
+
+	key := func(authorization, cookie string) string {
+		req := httptest.NewRequest("GET", "/v1/users/1", nil)
+		req.Header.Set("Authorization", authorization)
+		req.Header.Set("Cookie", cookie)
+		k, ok := policy.key(route, req)
+		if !ok {
+			t.Fatalf("key(%q, %q) not cacheable", authorization, cookie)
+		}
+		return k
+	}
+	if key("Bearer a", "session=a") == key("Bearer b", "session=a") {
+		t.Error("different tokens share a cache key")
+	}
+	if key("Bearer a", "session=a") == key("Bearer a", "session=b") {
+		t.Error("different cookies share a cache key")
+	}
+}
+
+func TestRateLimiterCredentialHeader(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "header:x-api-key", want: "X-Api-Key"},
+		{key: "client_ip", want: ""},
+		{key: "claim:sub", want: ""},
+	}
+	for _, tt := range tests {
+		l := newRateLimiter("test", RateLimitConfig{Rate: 1, Key: tt.key})
+		if got := l.credentialHeader(); got != tt.want {
+			t.Errorf("credentialHeader() for %q = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+	var disabled *rateLimiter
+	if got := disabled.credentialHeader(); got != "" {
+		t.Errorf("credentialHeader() of disabled limiter = %q, want empty", got)
+	}
+}
@@ -0,0 +1,851 @@
+package router
+
+import (
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gatewayv1 "pilot/proto/pilot/gateway/v1"
+)
+
+// Config 上游调用配置
+// 顶层字段为所有服务的默认值 Services 按服务名覆盖 etcd metadata 中的同名配置优先级最高
+type Config struct {
+	ServiceConfig `mapstructure:",squash"`
+	Services      []NamedServiceConfig `mapstructure:"services"`
+}
+
+// NamedServiceConfig 按服务名覆盖的配置
+// 使用列表而非 map 服务名中的 . 会被 viper 视为键分隔符
+type NamedServiceConfig struct {
+	Name          string `mapstructure:"name"`
+	ServiceConfig `mapstructure:",squash"`
+}
+
+// ServiceConfig 单个服务的上游配置
+type ServiceConfig struct {
+	Balancer    BalancerConfig    `mapstructure:"balancer"`
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
+	Outlier     OutlierConfig     `mapstructure:"outlier_detection"`
+	Breaker     BreakerConfig     `mapstructure:"circuit_breaker"`
+	Retry       RetryConfig       `mapstructure:"retry"`
+	Timeout     TimeoutConfig     `mapstructure:"timeout"`
+	TLS         TLSConfig         `mapstructure:"tls"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Body        BodyConfig        `mapstructure:"body"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	// Routes 按方法覆盖的配置 同一方法匹配多项时按顺序依次覆盖
+	Routes []RouteConfig `mapstructure:"routes"`
+}
+
+// RouteConfig 按方法覆盖的路由配置
+type RouteConfig struct {
+	// Method 方法名 可以是短名(GetUser)或全名(pkg.UserService/GetUser)
+	Method    string          `mapstructure:"method"`
+	Retry     RetryConfig     `mapstructure:"retry"`
+	Timeout   TimeoutConfig   `mapstructure:"timeout"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Body      BodyConfig      `mapstructure:"body"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *RouteConfig) merge(other RouteConfig) {
+	c.Retry.merge(other.Retry)
+	c.Timeout.merge(other.Timeout)
+	c.Auth.merge(other.Auth)
+	c.Body.merge(other.Body)
+	c.Cache.merge(other.Cache)
+	c.RateLimit.merge(other.RateLimit)
+}
+
+// BodyConfig 请求体配置
+type BodyConfig struct {
+	// MaxBytes 请求体大小上限 为 0 时仅受 http.max_body_bytes 限制 超过 http.max_body_bytes 的值不生效
+	MaxBytes int64 `mapstructure:"max_bytes"`
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *BodyConfig) merge(other BodyConfig) {
+	if other.MaxBytes > 0 {
+		c.MaxBytes = other.MaxBytes
+	}
+}
+
+// CacheConfig 响应缓存配置 仅用于 GET 一元调用
+type CacheConfig struct {
+	// TTL 缓存时长 为 0 时不缓存
+	TTL time.Duration `mapstructure:"ttl"`
+	// VaryHeaders 参与缓存键的请求头 未列出 Authorization 时携带 Authorization 的请求不使用缓存
+	VaryHeaders []string `mapstructure:"vary_headers"`
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *CacheConfig) merge(other CacheConfig) {
+	if other.TTL > 0 {
+		c.TTL = other.TTL
+	}
+	if len(other.VaryHeaders) > 0 {
+		c.VaryHeaders = other.VaryHeaders
+	}
+}
+
+// RateLimitConfig 令牌桶限流配置
+type RateLimitConfig struct {
+	// Rate 每秒补充的令牌数 为 0 时不限流
+	Rate float64 `mapstructure:"rate"`
+	// Burst 桶容量 即允许的突发请求数 为 0 时取 Rate 向上取整
+	Burst int `mapstructure:"burst"`
+	// Key 限流键 client_ip | header:<name> | claim:<name> | route 为空时为 client_ip
+	// header / claim 缺失时退化为客户端 IP route 表示该路由的全部请求共享一个令牌桶
+	Key string `mapstructure:"key"`
+}
+
+// enabled 是否开启限流
+func (c RateLimitConfig) enabled() bool {
+	return c.Rate > 0
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *RateLimitConfig) merge(other RateLimitConfig) {
+	if other.Rate > 0 {
+		c.Rate = other.Rate
+	}
+	if other.Burst > 0 {
+		c.Burst = other.Burst
+	}
+	if other.Key != "" {
+		c.Key = other.Key
+	}
+}
+
+// AuthConfig 路由的认证要求 仅在网关开启 JWT 认证时生效
+type AuthConfig struct {
+	// Required 是否必须携带有效令牌 为 false 时允许匿名访问(携带的令牌仍需有效) 未配置时为 true
+	Required *bool `mapstructure:"required"`
+}
+
+// required 是否必须认证
+func (c AuthConfig) required() bool {
+	return c.Required == nil || *c.Required
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *AuthConfig) merge(other AuthConfig) {
+	if other.Required != nil {
+		c.Required = other.Required
+	}
+}
+
+// TimeoutConfig 一元调用超时配置
+type TimeoutConfig struct {
+	// Default 调用方未指定超时时使用的超时 网关未配置时沿用 http.write_timeout
+	Default time.Duration `mapstructure:"default"`
+	// Max 调用方通过 grpc-timeout / X-Request-Timeout 指定超时的上限 为 0 时以 Default 为上限
+	Max time.Duration `mapstructure:"max"`
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *TimeoutConfig) merge(other TimeoutConfig) {
+	if other.Default > 0 {
+		c.Default = other.Default
+	}
+	if other.Max > 0 {
+		c.Max = other.Max
+	}
+}
+
+// BalancerConfig 负载均衡配置
+type BalancerConfig struct {
+	// Policy 负载均衡策略 round_robin | least_request | p2c_ewma | weighted_round_robin | consistent_hash
+	Policy string `mapstructure:"policy"`
+	// HashOn 一致性哈希的取值来源 header:<name> 或 path:<field>
+	HashOn string `mapstructure:"hash_on"`
+	// Weights 实例权重 格式为 host:port=weight 未配置的实例权重为 1
+	Weights []string `mapstructure:"weights"`
+}
+
+// HealthCheckConfig 主动健康检查配置 使用标准 grpc.health.v1.Health/Check
+type HealthCheckConfig struct {
+	// Interval 探测间隔 为 0 时关闭健康检查
+	Interval time.Duration `mapstructure:"interval"`
+	// Timeout 单次探测超时
+	Timeout time.Duration `mapstructure:"timeout"`
+	// UnhealthyThreshold 连续失败多少次后摘除实例
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold"`
+	// HealthyThreshold 连续成功多少次后恢复实例
+	HealthyThreshold int `mapstructure:"healthy_threshold"`
+	// Service 探测请求中的 service 字段 为空表示检查整个服务端
+	Service string `mapstructure:"service"`
+}
+
+// OutlierConfig 被动异常检测配置 依据一元调用结果驱逐异常实例
+type OutlierConfig struct {
+	// Enabled 是否开启 未配置时沿用上一级配置
+	Enabled *bool `mapstructure:"enabled"`
+	// ConsecutiveErrors 连续错误多少次后驱逐 为 0 时关闭连续错误检测
+	ConsecutiveErrors int `mapstructure:"consecutive_errors"`
+	// Interval 成功率分析与驱逐恢复的周期
+	Interval time.Duration `mapstructure:"interval"`
+	// BaseEjectionTime 首次驱逐时长 同一实例再次驱逐时按 2 的幂递增
+	BaseEjectionTime time.Duration `mapstructure:"base_ejection_time"`
+	// MaxEjectionTime 驱逐时长上限
+	MaxEjectionTime time.Duration `mapstructure:"max_ejection_time"`
+	// MaxEjectionPercent 同时被驱逐实例占比上限 至少允许驱逐一个且始终保留一个实例
+	MaxEjectionPercent int `mapstructure:"max_ejection_percent"`
+	// SuccessRateMinHosts 参与成功率分析的最少实例数
+	SuccessRateMinHosts int `mapstructure:"success_rate_min_hosts"`
+	// SuccessRateRequestVolume 实例在一个周期内参与成功率分析的最少请求数
+	SuccessRateRequestVolume int `mapstructure:"success_rate_request_volume"`
+	// SuccessRateStdevFactor 成功率低于 均值 - factor*标准差 时驱逐
+	SuccessRateStdevFactor float64 `mapstructure:"success_rate_stdev_factor"`
+}
+
+// enabled 是否开启异常检测
+func (c OutlierConfig) enabled() bool {
+	return c.Enabled != nil && *c.Enabled && c.Interval > 0
+}
+
+// BreakerConfig 熔断配置 按服务(可选按方法)统计滑动窗口内的错误率与慢调用率
+type BreakerConfig struct {
+	// Enabled 是否开启 未配置时沿用上一级配置
+	Enabled *bool `mapstructure:"enabled"`
+	// PerMethod 是否按方法独立熔断 未配置时沿用上一级配置
+	PerMethod *bool `mapstructure:"per_method"`
+	// Window 统计窗口
+	Window time.Duration `mapstructure:"window"`
+	// MinRequests 窗口内请求数达到该值后才会判断是否熔断
+	MinRequests int `mapstructure:"min_requests"`
+	// ErrorRate 错误率阈值(0~1) 为 0 时不按错误率熔断
+	ErrorRate float64 `mapstructure:"error_rate"`
+	// SlowCallDuration 耗时超过该值的调用视为慢调用
+	SlowCallDuration time.Duration `mapstructure:"slow_call_duration"`
+	// SlowCallRate 慢调用率阈值(0~1) 为 0 时不按慢调用率熔断
+	SlowCallRate float64 `mapstructure:"slow_call_rate"`
+	// OpenDuration 熔断打开时长 期间请求快速失败并返回 Retry-After
+	OpenDuration time.Duration `mapstructure:"open_duration"`
+	// HalfOpenRequests 半开状态放行的试探请求数 全部成功后关闭熔断
+	HalfOpenRequests int `mapstructure:"half_open_requests"`
+}
+
+// TLSConfig 上游传输安全配置 证书文件变化后自动重新加载
+type TLSConfig struct {
+	// Enabled 是否使用 TLS 连接上游 未配置时沿用上一级配置
+	Enabled *bool `mapstructure:"enabled"`
+	// CAFile 校验服务端证书的 CA 包 为空时使用系统 CA
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile / KeyFile 客户端证书与私钥 配置后启用 mTLS
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ServerName 覆盖 SNI 与证书校验使用的服务端名称 为空时使用实例地址中的主机名
+	ServerName string `mapstructure:"server_name"`
+	// SPIFFEIDs 允许的服务端 SPIFFE ID(如 spiffe://example.org/ns/prod/sa/user) 配置后按 URI SAN 校验而非主机名
+	// 仅含信任域(spiffe://example.org)时匹配该域下任意 ID
+	SPIFFEIDs []string `mapstructure:"spiffe_ids"`
+}
+
+// enabled 是否开启 TLS
+func (c TLSConfig) enabled() bool {
+	return c.Enabled != nil && *c.Enabled
+}
+
+// equal 比较两份 TLS 配置
+func (c TLSConfig) equal(other TLSConfig) bool {
+	if c.enabled() != other.enabled() {
+		return false
+	}
+	if !c.enabled() {
+		return true
+	}
+	return c.CAFile == other.CAFile && c.CertFile == other.CertFile && c.KeyFile == other.KeyFile &&
+		c.ServerName == other.ServerName && slices.Equal(c.SPIFFEIDs, other.SPIFFEIDs)
+}
+
+// RetryConfig 一元调用的重试与对冲配置 重试会换用其他实例
+type RetryConfig struct {
+	// MaxAttempts 最大尝试次数(含首次) 为 1 时关闭重试与对冲
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryOn 触发重试的 gRPC 状态码 如 UNAVAILABLE、RESOURCE_EXHAUSTED
+	RetryOn []string `mapstructure:"retry_on"`
+	// Idempotent 路由是否幂等 未配置时按 HTTP 方法判断(GET/HEAD/OPTIONS/PUT/DELETE 视为幂等) 非幂等路由不重试
+	Idempotent *bool `mapstructure:"idempotent"`
+	// PerTryTimeout 单次尝试超时 为 0 时不单独限制
+	PerTryTimeout time.Duration `mapstructure:"per_try_timeout"`
+	// BackoffBase 重试退避基准时长 按尝试次数指数增长并带随机抖动
+	BackoffBase time.Duration `mapstructure:"backoff_base"`
+	// BackoffMax 重试退避上限
+	BackoffMax time.Duration `mapstructure:"backoff_max"`
+	// BudgetPercent 重试预算 最近 10s 内重试(含对冲)数占请求数的比例上限(百分比) 仅服务级生效
+	BudgetPercent float64 `mapstructure:"budget_percent"`
+	// BudgetMinPerSecond 流量较低时每秒至少允许的重试数 仅服务级生效
+	BudgetMinPerSecond int `mapstructure:"budget_min_per_second"`
+	// HedgeDelay 对冲延迟 仅用于 GET 路由 首个尝试超过该时长未返回时向其他实例并发发起请求 为 0 时关闭对冲
+	HedgeDelay time.Duration `mapstructure:"hedge_delay"`
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *RetryConfig) merge(other RetryConfig) {
+	if other.MaxAttempts > 0 {
+		c.MaxAttempts = other.MaxAttempts
+	}
+	if len(other.RetryOn) > 0 {
+		c.RetryOn = other.RetryOn
+	}
+	if other.Idempotent != nil {
+		c.Idempotent = other.Idempotent
+	}
+	if other.PerTryTimeout > 0 {
+		c.PerTryTimeout = other.PerTryTimeout
+	}
+	if other.BackoffBase > 0 {
+		c.BackoffBase = other.BackoffBase
+	}
+	if other.BackoffMax > 0 {
+		c.BackoffMax = other.BackoffMax
+	}
+	if other.BudgetPercent > 0 {
+		c.BudgetPercent = other.BudgetPercent
+	}
+	if other.BudgetMinPerSecond > 0 {
+		c.BudgetMinPerSecond = other.BudgetMinPerSecond
+	}
+	if other.HedgeDelay > 0 {
+		c.HedgeDelay = other.HedgeDelay
+	}
+}
+
+// routeConfig 路由的最终配置
+// proto 中声明的策略优先于服务级配置 之后依次应用匹配该方法的覆盖项
+func (c ServiceConfig) routeConfig(route *Route) RouteConfig {
+	conf := RouteConfig{Method: route.FullMethod, Retry: c.Retry, Timeout: c.Timeout, Auth: c.Auth, Body: c.Body, Cache: c.Cache, RateLimit: c.RateLimit}
+	conf.merge(routeConfigFromPolicy(route.Policy))
+	for _, override := range c.Routes {
+		if override.Method == route.MethodName || override.Method == route.FullMethod {
+			conf.merge(override)
+		}
+	}
+	return conf
+}
+
+// routeConfigFromPolicy 将 proto 中声明的策略转换为路由配置
+func routeConfigFromPolicy(p *gatewayv1.Policy) RouteConfig {
+	var conf RouteConfig
+	if p == nil {
+		return conf
+	}
+	conf.Auth.Required = p.AuthRequired
+	conf.Retry.Idempotent = p.Idempotent
+	if d := p.GetTimeout().AsDuration(); d > 0 {
+		conf.Timeout.Default = d
+	}
+	if d := p.GetMaxTimeout().AsDuration(); d > 0 {
+		conf.Timeout.Max = d
+	}
+	conf.Body.MaxBytes = max(p.GetMaxBodyBytes(), 0)
+	if d := p.GetCache().GetTtl().AsDuration(); d > 0 {
+		conf.Cache.TTL = d
+	}
+	conf.Cache.VaryHeaders = p.GetCache().GetVaryHeaders()
+	conf.RateLimit.Rate = max(p.GetRateLimit().GetRate(), 0)
+	conf.RateLimit.Burst = int(p.GetRateLimit().GetBurst())
+	conf.RateLimit.Key = p.GetRateLimit().GetKey()
+	return conf
+}
+
+// enabled 是否开启熔断
+func (c BreakerConfig) enabled() bool {
+	return c.Enabled != nil && *c.Enabled && c.Window > 0
+}
+
+// perMethod 是否按方法独立熔断
+func (c BreakerConfig) perMethod() bool {
+	return c.PerMethod != nil && *c.PerMethod
+}
+
+// equal 比较两份熔断配置
+func (c BreakerConfig) equal(other BreakerConfig) bool {
+	a, b := c, other
+	a.Enabled, b.Enabled = nil, nil
+	a.PerMethod, b.PerMethod = nil, nil
+	return a == b && c.enabled() == other.enabled() && c.perMethod() == other.perMethod()
+}
+
+// equal 比较两份异常检测配置
+func (c OutlierConfig) equal(other OutlierConfig) bool {
+	a, b := c, other
+	a.Enabled, b.Enabled = nil, nil
+	return a == b && c.enabled() == other.enabled()
+}
+
+// etcd metadata 中的上游配置键
+const (
+	metaBalancerPolicy  = "lb.policy"
+	metaBalancerHashOn  = "lb.hash_on"
+	metaBalancerWeights = "lb.weights" // host:port=weight 逗号分隔
+
+	metaHealthInterval           = "health.interval"
+	metaHealthTimeout            = "health.timeout"
+	metaHealthUnhealthyThreshold = "health.unhealthy_threshold"
+	metaHealthHealthyThreshold   = "health.healthy_threshold"
+	metaHealthService            = "health.service"
+
+	metaOutlierEnabled                  = "outlier.enabled"
+	metaOutlierConsecutiveErrors        = "outlier.consecutive_errors"
+	metaOutlierInterval                 = "outlier.interval"
+	metaOutlierBaseEjectionTime         = "outlier.base_ejection_time"
+	metaOutlierMaxEjectionTime          = "outlier.max_ejection_time"
+	metaOutlierMaxEjectionPercent       = "outlier.max_ejection_percent"
+	metaOutlierSuccessRateMinHosts      = "outlier.success_rate_min_hosts"
+	metaOutlierSuccessRateRequestVolume = "outlier.success_rate_request_volume"
+	metaOutlierSuccessRateStdevFactor   = "outlier.success_rate_stdev_factor"
+
+	metaBreakerEnabled          = "cb.enabled"
+	metaBreakerPerMethod        = "cb.per_method"
+	metaBreakerWindow           = "cb.window"
+	metaBreakerMinRequests      = "cb.min_requests"
+	metaBreakerErrorRate        = "cb.error_rate"
+	metaBreakerSlowCallDuration = "cb.slow_call_duration"
+	metaBreakerSlowCallRate     = "cb.slow_call_rate"
+	metaBreakerOpenDuration     = "cb.open_duration"
+	metaBreakerHalfOpenRequests = "cb.half_open_requests"
+
+	metaRetryMaxAttempts        = "retry.max_attempts"
+	metaRetryOn                 = "retry.on" // 状态码名称 逗号分隔
+	metaRetryIdempotent         = "retry.idempotent"
+	metaRetryPerTryTimeout      = "retry.per_try_timeout"
+	metaRetryBackoffBase        = "retry.backoff_base"
+	metaRetryBackoffMax         = "retry.backoff_max"
+	metaRetryBudgetPercent      = "retry.budget_percent"
+	metaRetryBudgetMinPerSecond = "retry.budget_min_per_second"
+	metaRetryHedgeDelay         = "retry.hedge_delay"
+
+	metaTimeoutDefault = "timeout.default"
+	metaTimeoutMax     = "timeout.max"
+
+	metaTLSEnabled    = "tls.enabled"
+	metaTLSCAFile     = "tls.ca_file"
+	metaTLSCertFile   = "tls.cert_file"
+	metaTLSKeyFile    = "tls.key_file"
+	metaTLSServerName = "tls.server_name"
+	metaTLSSPIFFEIDs  = "tls.spiffe_ids" // 逗号分隔
+
+	metaAuthRequired = "auth.required"
+
+	metaBodyMaxBytes     = "body.max_bytes"
+	metaCacheTTL         = "cache.ttl"
+	metaCacheVaryHeaders = "cache.vary_headers" // 逗号分隔
+
+	metaRateLimitRate  = "ratelimit.rate"
+	metaRateLimitBurst = "ratelimit.burst"
+	metaRateLimitKey   = "ratelimit.key"
+
+	// metaMethodPrefix 按方法覆盖的键前缀 如 method.GetUser.retry.max_attempts
+	metaMethodPrefix = "method."
+)
+
+// DefaultConfig 默认上游配置
+func DefaultConfig() Config {
+	enabled := true
+	return Config{
+		ServiceConfig: ServiceConfig{
+			Balancer: BalancerConfig{Policy: PolicyRoundRobin},
+			HealthCheck: HealthCheckConfig{
+				Timeout:            time.Second,
+				UnhealthyThreshold: 3,
+				HealthyThreshold:   2,
+			},
+			Outlier: OutlierConfig{
+				Enabled:                  &enabled,
+				ConsecutiveErrors:        5,
+				Interval:                 10 * time.Second,
+				BaseEjectionTime:         30 * time.Second,
+				MaxEjectionTime:          300 * time.Second,
+				MaxEjectionPercent:       10,
+				SuccessRateMinHosts:      5,
+				SuccessRateRequestVolume: 100,
+				SuccessRateStdevFactor:   1.9,
+			},
+			Breaker: BreakerConfig{
+				Window:           10 * time.Second,
+				MinRequests:      20,
+				ErrorRate:        0.5,
+				OpenDuration:     30 * time.Second,
+				HalfOpenRequests: 3,
+			},
+			Retry: RetryConfig{
+				MaxAttempts:        3,
+				RetryOn:            []string{"UNAVAILABLE"},
+				BackoffBase:        25 * time.Millisecond,
+				BackoffMax:         250 * time.Millisecond,
+				BudgetPercent:      20,
+				BudgetMinPerSecond: 10,
+			},
+		},
+	}
+}
+
+// serviceConfig 合并默认配置、服务级配置与 etcd metadata 得到服务的最终配置
+func (c Config) serviceConfig(serviceName string, metadata map[string]string) ServiceConfig {
+	conf := c.ServiceConfig
+	for _, override := range c.Services {
+		if override.Name == serviceName {
+			conf.merge(override.ServiceConfig)
+		}
+	}
+	conf.merge(serviceConfigFromMetadata(serviceName, metadata))
+	return conf
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *ServiceConfig) merge(other ServiceConfig) {
+	if other.Balancer.Policy != "" {
+		c.Balancer.Policy = other.Balancer.Policy
+	}
+	if other.Balancer.HashOn != "" {
+		c.Balancer.HashOn = other.Balancer.HashOn
+	}
+	if len(other.Balancer.Weights) > 0 {
+		c.Balancer.Weights = other.Balancer.Weights
+	}
+
+	if other.HealthCheck.Interval > 0 {
+		c.HealthCheck.Interval = other.HealthCheck.Interval
+	}
+	if other.HealthCheck.Timeout > 0 {
+		c.HealthCheck.Timeout = other.HealthCheck.Timeout
+	}
+	if other.HealthCheck.UnhealthyThreshold > 0 {
+		c.HealthCheck.UnhealthyThreshold = other.HealthCheck.UnhealthyThreshold
+	}
+	if other.HealthCheck.HealthyThreshold > 0 {
+		c.HealthCheck.HealthyThreshold = other.HealthCheck.HealthyThreshold
+	}
+	if other.HealthCheck.Service != "" {
+		c.HealthCheck.Service = other.HealthCheck.Service
+	}
+
+	if other.Outlier.Enabled != nil {
+		c.Outlier.Enabled = other.Outlier.Enabled
+	}
+	if other.Outlier.ConsecutiveErrors > 0 {
+		c.Outlier.ConsecutiveErrors = other.Outlier.ConsecutiveErrors
+	}
+	if other.Outlier.Interval > 0 {
+		c.Outlier.Interval = other.Outlier.Interval
+	}
+	if other.Outlier.BaseEjectionTime > 0 {
+		c.Outlier.BaseEjectionTime = other.Outlier.BaseEjectionTime
+	}
+	if other.Outlier.MaxEjectionTime > 0 {
+		c.Outlier.MaxEjectionTime = other.Outlier.MaxEjectionTime
+	}
+	if other.Outlier.MaxEjectionPercent > 0 {
+		c.Outlier.MaxEjectionPercent = other.Outlier.MaxEjectionPercent
+	}
+	if other.Outlier.SuccessRateMinHosts > 0 {
+		c.Outlier.SuccessRateMinHosts = other.Outlier.SuccessRateMinHosts
+	}
+	if other.Outlier.SuccessRateRequestVolume > 0 {
+		c.Outlier.SuccessRateRequestVolume = other.Outlier.SuccessRateRequestVolume
+	}
+	if other.Outlier.SuccessRateStdevFactor > 0 {
+		c.Outlier.SuccessRateStdevFactor = other.Outlier.SuccessRateStdevFactor
+	}
+
+	if other.Breaker.Enabled != nil {
+		c.Breaker.Enabled = other.Breaker.Enabled
+	}
+	if other.Breaker.PerMethod != nil {
+		c.Breaker.PerMethod = other.Breaker.PerMethod
+	}
+	if other.Breaker.Window > 0 {
+		c.Breaker.Window = other.Breaker.Window
+	}
+	if other.Breaker.MinRequests > 0 {
+		c.Breaker.MinRequests = other.Breaker.MinRequests
+	}
+	if other.Breaker.ErrorRate > 0 {
+		c.Breaker.ErrorRate = other.Breaker.ErrorRate
+	}
+	if other.Breaker.SlowCallDuration > 0 {
+		c.Breaker.SlowCallDuration = other.Breaker.SlowCallDuration
+	}
+	if other.Breaker.SlowCallRate > 0 {
+		c.Breaker.SlowCallRate = other.Breaker.SlowCallRate
+	}
+	if other.Breaker.OpenDuration > 0 {
+		c.Breaker.OpenDuration = other.Breaker.OpenDuration
+	}
+	if other.Breaker.HalfOpenRequests > 0 {
+		c.Breaker.HalfOpenRequests = other.Breaker.HalfOpenRequests
+	}
+
+	c.Retry.merge(other.Retry)
+	c.Timeout.merge(other.Timeout)
+	c.Auth.merge(other.Auth)
+	c.Body.merge(other.Body)
+	c.Cache.merge(other.Cache)
+	c.RateLimit.merge(other.RateLimit)
+
+	if other.TLS.Enabled != nil {
+		c.TLS.Enabled = other.TLS.Enabled
+	}
+	if other.TLS.CAFile != "" {
+		c.TLS.CAFile = other.TLS.CAFile
+	}
+	if other.TLS.CertFile != "" {
+		c.TLS.CertFile = other.TLS.CertFile
+	}
+	if other.TLS.KeyFile != "" {
+		c.TLS.KeyFile = other.TLS.KeyFile
+	}
+	if other.TLS.ServerName != "" {
+		c.TLS.ServerName = other.TLS.ServerName
+	}
+	if len(other.TLS.SPIFFEIDs) > 0 {
+		c.TLS.SPIFFEIDs = other.TLS.SPIFFEIDs
+	}
+
+	if len(other.Routes) > 0 {
+		c.Routes = append(slices.Clone(c.Routes), other.Routes...)
+	}
+}
+
+// serviceConfigFromMetadata 从 etcd metadata 中读取服务配置 非法取值忽略并告警
+func serviceConfigFromMetadata(serviceName string, metadata map[string]string) ServiceConfig {
+	var conf ServiceConfig
+	conf.Balancer.Policy = strings.TrimSpace(metadata[metaBalancerPolicy])
+	conf.Balancer.HashOn = strings.TrimSpace(metadata[metaBalancerHashOn])
+	if weights := strings.TrimSpace(metadata[metaBalancerWeights]); weights != "" {
+		conf.Balancer.Weights = strings.Split(weights, ",")
+	}
+
+	conf.HealthCheck.Interval = metaDuration(serviceName, metadata, metaHealthInterval)
+	conf.HealthCheck.Timeout = metaDuration(serviceName, metadata, metaHealthTimeout)
+	conf.HealthCheck.UnhealthyThreshold = metaInt(serviceName, metadata, metaHealthUnhealthyThreshold)
+	conf.HealthCheck.HealthyThreshold = metaInt(serviceName, metadata, metaHealthHealthyThreshold)
+	conf.HealthCheck.Service = strings.TrimSpace(metadata[metaHealthService])
+
+	conf.Outlier.Enabled = metaBool(serviceName, metadata, metaOutlierEnabled)
+	conf.Outlier.ConsecutiveErrors = metaInt(serviceName, metadata, metaOutlierConsecutiveErrors)
+	conf.Outlier.Interval = metaDuration(serviceName, metadata, metaOutlierInterval)
+	conf.Outlier.BaseEjectionTime = metaDuration(serviceName, metadata, metaOutlierBaseEjectionTime)
+	conf.Outlier.MaxEjectionTime = metaDuration(serviceName, metadata, metaOutlierMaxEjectionTime)
+	conf.Outlier.MaxEjectionPercent = metaInt(serviceName, metadata, metaOutlierMaxEjectionPercent)
+	conf.Outlier.SuccessRateMinHosts = metaInt(serviceName, metadata, metaOutlierSuccessRateMinHosts)
+	conf.Outlier.SuccessRateRequestVolume = metaInt(serviceName, metadata, metaOutlierSuccessRateRequestVolume)
+	conf.Outlier.SuccessRateStdevFactor = metaFloat(serviceName, metadata, metaOutlierSuccessRateStdevFactor)
+
+	conf.Breaker.Enabled = metaBool(serviceName, metadata, metaBreakerEnabled)
+	conf.Breaker.PerMethod = metaBool(serviceName, metadata, metaBreakerPerMethod)
+	conf.Breaker.Window = metaDuration(serviceName, metadata, metaBreakerWindow)
+	conf.Breaker.MinRequests = metaInt(serviceName, metadata, metaBreakerMinRequests)
+	conf.Breaker.ErrorRate = metaFloat(serviceName, metadata, metaBreakerErrorRate)
+	conf.Breaker.SlowCallDuration = metaDuration(serviceName, metadata, metaBreakerSlowCallDuration)
+	conf.Breaker.SlowCallRate = metaFloat(serviceName, metadata, metaBreakerSlowCallRate)
+	conf.Breaker.OpenDuration = metaDuration(serviceName, metadata, metaBreakerOpenDuration)
+	conf.Breaker.HalfOpenRequests = metaInt(serviceName, metadata, metaBreakerHalfOpenRequests)
+
+	conf.Retry = retryConfigFromMetadata(serviceName, metadata)
+	conf.Timeout = timeoutConfigFromMetadata(serviceName, metadata)
+	conf.Auth = authConfigFromMetadata(serviceName, metadata)
+	conf.Body = bodyConfigFromMetadata(serviceName, metadata)
+	conf.Cache = cacheConfigFromMetadata(serviceName, metadata)
+	conf.RateLimit = rateLimitConfigFromMetadata(serviceName, metadata)
+
+	conf.TLS.Enabled = metaBool(serviceName, metadata, metaTLSEnabled)
+	conf.TLS.CAFile = strings.TrimSpace(metadata[metaTLSCAFile])
+	conf.TLS.CertFile = strings.TrimSpace(metadata[metaTLSCertFile])
+	conf.TLS.KeyFile = strings.TrimSpace(metadata[metaTLSKeyFile])
+	conf.TLS.ServerName = strings.TrimSpace(metadata[metaTLSServerName])
+	conf.TLS.SPIFFEIDs = metaList(metadata, metaTLSSPIFFEIDs)
+	conf.Routes = routeConfigsFromMetadata(serviceName, metadata)
+	return conf
+}
+
+// retryConfigFromMetadata 从 metadata 中读取重试配置
+func retryConfigFromMetadata(serviceName string, metadata map[string]string) RetryConfig {
+	var conf RetryConfig
+	conf.MaxAttempts = metaInt(serviceName, metadata, metaRetryMaxAttempts)
+	conf.RetryOn = metaList(metadata, metaRetryOn)
+	conf.Idempotent = metaBool(serviceName, metadata, metaRetryIdempotent)
+	conf.PerTryTimeout = metaDuration(serviceName, metadata, metaRetryPerTryTimeout)
+	conf.BackoffBase = metaDuration(serviceName, metadata, metaRetryBackoffBase)
+	conf.BackoffMax = metaDuration(serviceName, metadata, metaRetryBackoffMax)
+	conf.BudgetPercent = metaFloat(serviceName, metadata, metaRetryBudgetPercent)
+	conf.BudgetMinPerSecond = metaInt(serviceName, metadata, metaRetryBudgetMinPerSecond)
+	conf.HedgeDelay = metaDuration(serviceName, metadata, metaRetryHedgeDelay)
+	return conf
+}
+
+// timeoutConfigFromMetadata 从 metadata 中读取超时配置
+func timeoutConfigFromMetadata(serviceName string, metadata map[string]string) TimeoutConfig {
+	return TimeoutConfig{
+		Default: metaDuration(serviceName, metadata, metaTimeoutDefault),
+		Max:     metaDuration(serviceName, metadata, metaTimeoutMax),
+	}
+}
+
+// authConfigFromMetadata 从 metadata 中读取认证要求
+func authConfigFromMetadata(serviceName string, metadata map[string]string) AuthConfig {
+	return AuthConfig{Required: metaBool(serviceName, metadata, metaAuthRequired)}
+}
+
+// bodyConfigFromMetadata 从 metadata 中读取请求体配置
+func bodyConfigFromMetadata(serviceName string, metadata map[string]string) BodyConfig {
+	return BodyConfig{MaxBytes: int64(metaInt(serviceName, metadata, metaBodyMaxBytes))}
+}
+
+// cacheConfigFromMetadata 从 metadata 中读取响应缓存配置
+func cacheConfigFromMetadata(serviceName string, metadata map[string]string) CacheConfig {
+	return CacheConfig{
+		TTL:         metaDuration(serviceName, metadata, metaCacheTTL),
+		VaryHeaders: metaList(metadata, metaCacheVaryHeaders),
+	}
+}
+
+// rateLimitConfigFromMetadata 从 metadata 中读取限流配置
+func rateLimitConfigFromMetadata(serviceName string, metadata map[string]string) RateLimitConfig {
+	return RateLimitConfig{
+		Rate:  metaFloat(serviceName, metadata, metaRateLimitRate),
+		Burst: metaInt(serviceName, metadata, metaRateLimitBurst),
+		Key:   strings.TrimSpace(metadata[metaRateLimitKey]),
+	}
+}
+
+// methodSections 支持按方法覆盖的配置段
+var methodSections = []string{"retry", "timeout", "auth", "body", "cache", "ratelimit"}
+
+// routeConfigsFromMetadata 读取按方法覆盖的配置 键格式为 method.<方法名>.<配置键> 按方法名排序
+func routeConfigsFromMetadata(serviceName string, metadata map[string]string) []RouteConfig {
+	methods := make(map[string]map[string]string)
+	for key, value := range metadata {
+		rest, ok := strings.CutPrefix(key, metaMethodPrefix)
+		if !ok {
+			continue
+		}
+		idx := -1
+		for _, section := range methodSections {
+			idx = max(idx, strings.LastIndex(rest, "."+section+"."))
+		}
+		if idx <= 0 {
+			log.Printf("Warning: unsupported metadata key %q for service %s, expected %s<method>.<%s>.<option>", key, serviceName, metaMethodPrefix, strings.Join(methodSections, "|"))
+			continue
+		}
+		name := rest[:idx]
+		if methods[name] == nil {
+			methods[name] = make(map[string]string)
+		}
+		methods[name][rest[idx+1:]] = value
+	}
+
+	routes := make([]RouteConfig, 0, len(methods))
+	for _, name := range slices.Sorted(maps.Keys(methods)) {
+		scope := serviceName + " method " + name
+		routes = append(routes, RouteConfig{
+			Method:    name,
+			Retry:     retryConfigFromMetadata(scope, methods[name]),
+			Timeout:   timeoutConfigFromMetadata(scope, methods[name]),
+			Auth:      authConfigFromMetadata(scope, methods[name]),
+			Body:      bodyConfigFromMetadata(scope, methods[name]),
+			Cache:     cacheConfigFromMetadata(scope, methods[name]),
+			RateLimit: rateLimitConfigFromMetadata(scope, methods[name]),
+		})
+	}
+	return routes
+}
+
+// metaList 读取 metadata 中逗号分隔的列表 忽略空项
+func metaList(metadata map[string]string, key string) []string {
+	var out []string
+	for _, item := range strings.Split(metadata[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// metaBool 读取 metadata 中的布尔值 未配置时返回 nil
+func metaBool(serviceName string, metadata map[string]string, key string) *bool {
+	raw := strings.TrimSpace(metadata[key])
+	if raw == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q for service %s, expected true or false", key, raw, serviceName)
+		return nil
+	}
+	return &b
+}
+
+// metaFloat 读取 metadata 中的非负浮点数
+func metaFloat(serviceName string, metadata map[string]string, key string) float64 {
+	raw := strings.TrimSpace(metadata[key])
+	if raw == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 0 {
+		log.Printf("Warning: invalid %s %q for service %s, expected a non-negative number", key, raw, serviceName)
+		return 0
+	}
+	return f
+}
+
+// metaDuration 读取 metadata 中的时长 如 500ms、2s
+func metaDuration(serviceName string, metadata map[string]string, key string) time.Duration {
+	raw := strings.TrimSpace(metadata[key])
+	if raw == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("Warning: invalid %s %q for service %s, expected a duration such as 500ms", key, raw, serviceName)
+		return 0
+	}
+	return d
+}
+
+// metaInt 读取 metadata 中的正整数
+func metaInt(serviceName string, metadata map[string]string, key string) int {
+	raw := strings.TrimSpace(metadata[key])
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q for service %s, expected a non-negative integer", key, raw, serviceName)
+		return 0
+	}
+	return n
+}
+
+// parseWeights 解析实例权重 非法项忽略并告警
+func parseWeights(serviceName string, items []string) map[string]int {
+	weights := make(map[string]int, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx := strings.LastIndex(item, "=")
+		if idx <= 0 {
+			log.Printf("Warning: invalid weight %q for service %s, expected host:port=weight", item, serviceName)
+			continue
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(item[idx+1:]))
+		if err != nil || w <= 0 {
+			log.Printf("Warning: invalid weight %q for service %s, expected a positive integer", item, serviceName)
+			continue
+		}
+		weights[strings.TrimSpace(item[:idx])] = w
+	}
+	return weights
+}
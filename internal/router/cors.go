@@ -0,0 +1,300 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 跨域策略 网关配置为全局默认 服务可通过 etcd metadata 覆盖
+type CORSConfig struct {
+	// AllowedOrigins 允许的来源 支持精确匹配(https://app.example.com)、子域通配(https://*.example.com)与 *
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowedOriginPatterns 允许的来源正则 需匹配完整 Origin
+	AllowedOriginPatterns []string `mapstructure:"allowed_origin_patterns"`
+	// AllowedMethods 允许的方法 预检响应取其与路径上实际注册方法的交集
+	AllowedMethods []string `mapstructure:"allowed_methods"`
+	// AllowedHeaders 允许的请求头 * 表示允许预检请求声明的任意请求头
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+	// ExposedHeaders 允许浏览器读取的响应头
+	ExposedHeaders []string `mapstructure:"exposed_headers"`
+	// AllowCredentials 是否允许携带凭证 未配置时沿用上一级配置
+	AllowCredentials *bool `mapstructure:"allow_credentials"`
+	// MaxAge 预检结果缓存时长
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// DefaultCORSConfig 默认跨域策略 未配置允许的来源时不放行任何跨域请求
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With", "X-Csrf-Token"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// merge 使用 other 中的非零字段覆盖当前配置
+func (c *CORSConfig) merge(other CORSConfig) {
+	if len(other.AllowedOrigins) > 0 {
+		c.AllowedOrigins = other.AllowedOrigins
+	}
+	if len(other.AllowedOriginPatterns) > 0 {
+		c.AllowedOriginPatterns = other.AllowedOriginPatterns
+	}
+	if len(other.AllowedMethods) > 0 {
+		c.AllowedMethods = other.AllowedMethods
+	}
+	if len(other.AllowedHeaders) > 0 {
+		c.AllowedHeaders = other.AllowedHeaders
+	}
+	if len(other.ExposedHeaders) > 0 {
+		c.ExposedHeaders = other.ExposedHeaders
+	}
+	if other.AllowCredentials != nil {
+		c.AllowCredentials = other.AllowCredentials
+	}
+	if other.MaxAge > 0 {
+		c.MaxAge = other.MaxAge
+	}
+}
+
+// etcd metadata 中的跨域配置键 列表均为逗号分隔
+const (
+	metaCORSAllowedOrigins        = "cors.allowed_origins"
+	metaCORSAllowedOriginPatterns = "cors.allowed_origin_patterns"
+	metaCORSAllowedMethods        = "cors.allowed_methods"
+	metaCORSAllowedHeaders        = "cors.allowed_headers"
+	metaCORSExposedHeaders        = "cors.exposed_headers"
+	metaCORSAllowCredentials      = "cors.allow_credentials"
+	metaCORSMaxAge                = "cors.max_age"
+)
+
+// corsConfigFromMetadata 从 etcd metadata 中读取跨域配置
+func corsConfigFromMetadata(serviceName string, metadata map[string]string) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:        metaList(metadata, metaCORSAllowedOrigins),
+		AllowedOriginPatterns: metaList(metadata, metaCORSAllowedOriginPatterns),
+		AllowedMethods:        metaList(metadata, metaCORSAllowedMethods),
+		AllowedHeaders:        metaList(metadata, metaCORSAllowedHeaders),
+		ExposedHeaders:        metaList(metadata, metaCORSExposedHeaders),
+		AllowCredentials:      metaBool(serviceName, metadata, metaCORSAllowCredentials),
+		MaxAge:                metaDuration(serviceName, metadata, metaCORSMaxAge),
+	}
+}
+
+// corsPolicy 编译后的跨域策略
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]struct{}
+	wildcards   []string // 子域通配 如 https://*.example.com
+	patterns    []*regexp.Regexp
+	methods     []string
+	headers     []string
+	anyHeader   bool
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// newCORSPolicy 编译跨域策略 非法的来源正则忽略并告警
+func newCORSPolicy(scope string, conf CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:     make(map[string]struct{}),
+		exposed:     strings.Join(conf.ExposedHeaders, ", "),
+		credentials: conf.AllowCredentials != nil && *conf.AllowCredentials,
+	}
+	for _, origin := range conf.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			p.wildcards = append(p.wildcards, origin)
+		case origin != "":
+			p.origins[origin] = struct{}{}
+		}
+	}
+	for _, expr := range conf.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			log.Printf("Warning: invalid CORS origin pattern %q for %s: %v", expr, scope, err)
+			continue
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	for _, m := range conf.AllowedMethods {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			p.methods = append(p.methods, m)
+		}
+	}
+	for _, h := range conf.AllowedHeaders {
+		h = strings.TrimSpace(h)
+		if h == "*" {
+			p.anyHeader = true
+		} else if h != "" {
+			p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+	if conf.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(conf.MaxAge / time.Second))
+	}
+	if p.anyOrigin && p.credentials {
+		log.Printf("Warning: CORS policy for %s allows credentials from any origin", scope)
+	}
+	return p
+}
+
+// allowOrigin 判断来源是否被允许
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := p.origins[origin]; ok {
+		return true
+	}
+	for _, w := range p.wildcards {
+		// https://*.example.com 匹配 https://a.example.com、https://a.b.example.com
+		idx := strings.Index(w, "*")
+		prefix, suffix := w[:idx], w[idx+1:]
+		if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrigin 写入来源相关的响应头 允许任意来源且不携带凭证时返回 * 其余情况回显来源
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// apply 为实际请求写入跨域响应头 来源不被允许时不写入 由浏览器拦截
+func (p *corsPolicy) apply(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	if !p.anyOrigin || p.credentials {
+		w.Header().Add("Vary", "Origin")
+	}
+	if !p.allowOrigin(origin) {
+		return
+	}
+	p.setOrigin(w.Header(), origin)
+	if p.exposed != "" {
+		w.Header().Set("Access-Control-Expose-Headers", p.exposed)
+	}
+}
+
+// isPreflight 是否为 CORS 预检请求
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflightMethods 预检时探测的候选方法
+var preflightMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+
+// servePreflight 响应预检请求 允许的方法为路径上实际注册的方法与策略的交集
+func (r *HTTPRouter) servePreflight(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	requested := strings.ToUpper(strings.TrimSpace(req.Header.Get("Access-Control-Request-Method")))
+	path := req.URL.EscapedPath()
+
+	// 以请求方法对应路由所属服务的策略为准
+	route, _, ok, _ := r.match(requested, path)
+	policy := r.cors
+	if ok {
+		policy = r.corsPolicy(route.ServiceName)
+	}
+
+	registered := make([]string, 0, len(preflightMethods))
+	for _, m := range slices.Concat(preflightMethods, policy.methods) {
+		if slices.Contains(registered, m) {
+			continue
+		}
+		if _, _, found, _ := r.match(m, path); found {
+			registered = append(registered, m)
+		}
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if len(registered) == 0 {
+		writeJSON(w, http.StatusNotFound, Result{
+			Code: http.StatusNotFound,
+			Msg:  fmt.Sprintf("No route found for %s", req.URL.Path),
+			Data: nil,
+		})
+		return
+	}
+	if !policy.allowOrigin(origin) {
+		writeJSON(w, http.StatusForbidden, Result{
+			Code: http.StatusForbidden,
+			Msg:  fmt.Sprintf("CORS origin %s is not allowed", origin),
+			Data: nil,
+		})
+		return
+	}
+
+	allowed := make([]string, 0, len(registered))
+	for _, m := range registered {
+		if slices.Contains(policy.methods, m) {
+			allowed = append(allowed, m)
+		}
+	}
+	if !ok || !slices.Contains(allowed, requested) {
+		writeJSON(w, http.StatusForbidden, Result{
+			Code: http.StatusForbidden,
+			Msg:  fmt.Sprintf("CORS method %s is not allowed for %s", requested, req.URL.Path),
+			Data: nil,
+		})
+		return
+	}
+
+	policy.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+	if reqHeaders := strings.TrimSpace(req.Header.Get("Access-Control-Request-Headers")); reqHeaders != "" {
+		if policy.anyHeader {
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		} else {
+			h.Set("Access-Control-Allow-Headers", strings.Join(policy.headers, ", "))
+		}
+	}
+	if policy.maxAge != "" {
+		h.Set("Access-Control-Max-Age", policy.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// corsPolicy 获取服务的跨域策略 服务未覆盖时使用全局策略
+func (r *HTTPRouter) corsPolicy(serviceName string) *corsPolicy {
+	r.mu.RLock()
+	pool, ok := r.servicePools[serviceName]
+	r.mu.RUnlock()
+	if ok {
+		if p := pool.cors.Load(); p != nil {
+			return p
+		}
+	}
+	return r.cors
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 调用方指定超时的请求头 同时存在时 grpc-timeout 优先
+const (
+	grpcTimeoutHeader    = "Grpc-Timeout"
+	requestTimeoutHeader = "X-Request-Timeout"
+)
+
+// timeoutPolicy 单个路由的超时策略
+type timeoutPolicy struct {
+	def time.Duration // 调用方未指定时的超时 为 0 时不限制
+	max time.Duration // 调用方指定超时的上限 为 0 时不限制
+}
+
+func newTimeoutPolicy(conf TimeoutConfig) timeoutPolicy {
+	policy := timeoutPolicy{def: conf.Default, max: conf.Max}
+	if policy.max <= 0 {
+		policy.max = policy.def
+	}
+	return policy
+}
+
+// resolve 计算本次调用的超时 调用方指定的超时不超过上限 返回 0 表示不限制
+func (p timeoutPolicy) resolve(req *http.Request) (time.Duration, error) {
+	requested, ok, err := requestedTimeout(req)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return p.def, nil
+	}
+	if p.max > 0 && requested > p.max {
+		return p.max, nil
+	}
+	return requested, nil
+}
+
+// requestedTimeout 读取调用方指定的超时
+func requestedTimeout(req *http.Request) (time.Duration, bool, error) {
+	if v := strings.TrimSpace(req.Header.Get(grpcTimeoutHeader)); v != "" {
+		d, err := parseGRPCTimeout(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid grpc-timeout header %q: %w", v, err)
+		}
+		return d, true, nil
+	}
+	if v := strings.TrimSpace(req.Header.Get(requestTimeoutHeader)); v != "" {
+		d, err := parseRequestTimeout(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s header %q: %w", requestTimeoutHeader, v, err)
+		}
+		return d, true, nil
+	}
+	return 0, false, nil
+}
+
+// grpcTimeoutUnits grpc-timeout 的单位
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout 解析 gRPC 协议格式的超时 如 500m、3S 最多 8 位数字
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("expected 1-8 digits followed by a unit")
+	}
+	unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q, expected one of H M S m u n", v[len(v)-1])
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected 1-8 digits followed by a unit")
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	// 避免溢出
+	if n > int64(time.Duration(math.MaxInt64)/unit) {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseRequestTimeout 解析 X-Request-Timeout 支持时长(如 1.5s、500ms)或秒数
+func parseRequestTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(v, 64)
+		if ferr != nil || math.IsNaN(secs) || math.IsInf(secs, 0) || secs > math.MaxInt64/float64(time.Second) {
+			return 0, fmt.Errorf("expected a duration such as 500ms or a number of seconds")
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	return d, nil
+}
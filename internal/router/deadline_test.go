@@ -0,0 +1,160 @@
+package router
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "1H", want: time.Hour},
+		{in: "2M", want: 2 * time.Minute},
+		{in: "3S", want: 3 * time.Second},
+		{in: "500m", want: 500 * time.Millisecond},
+		{in: "250u", want: 250 * time.Microsecond},
+		{in: "100n", want: 100 * time.Nanosecond},
+		{in: "99999999S", want: 99999999 * time.Second},
+		{in: "99999999H", want: time.Duration(math.MaxInt64)},
+		{in: "0S", wantErr: true},
+		{in: "S", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "10s", wantErr: true},
+		{in: "1.5S", wantErr: true},
+		{in: "-1S", wantErr: true},
+		{in: "+1S", want: time.Second},
+		{in: "123456789S", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseGRPCTimeout(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGRPCTimeout(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseGRPCTimeout(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "1.5s", want: 1500 * time.Millisecond},
+		{in: "500ms", want: 500 * time.Millisecond},
+		{in: "2", want: 2 * time.Second},
+		{in: "0.25", want: 250 * time.Millisecond},
+		{in: "0", wantErr: true},
+		{in: "-1s", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "1e300", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRequestTimeout(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRequestTimeout(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseRequestTimeout(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutPolicyResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    TimeoutConfig
+		headers map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "default without header",
+			conf: TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			want: 5 * time.Second,
+		},
+		{
+			name:    "grpc-timeout below max",
+			conf:    TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "10S"},
+			want:    10 * time.Second,
+		},
+		{
+			name:    "grpc-timeout clamped to max",
+			conf:    TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "2M"},
+			want:    30 * time.Second,
+		},
+		{
+			name:    "overflowing grpc-timeout clamped to max",
+			conf:    TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "99999999H"},
+			want:    30 * time.Second,
+		},
+		{
+			name:    "max defaults to default",
+			conf:    TimeoutConfig{Default: 5 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "10S"},
+			want:    5 * time.Second,
+		},
+		{
+			name:    "no limit",
+			conf:    TimeoutConfig{},
+			headers: map[string]string{grpcTimeoutHeader: "10S"},
+			want:    10 * time.Second,
+		},
+		{
+			name:    "grpc-timeout takes precedence",
+			conf:    TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "1S", requestTimeoutHeader: "2s"},
+			want:    time.Second,
+		},
+		{
+			name:    "x-request-timeout clamped to max",
+			conf:    TimeoutConfig{Default: 5 * time.Second, Max: 30 * time.Second},
+			headers: map[string]string{requestTimeoutHeader: "60"},
+			want:    30 * time.Second,
+		},
+		{
+			name:    "invalid grpc-timeout",
+			conf:    TimeoutConfig{Default: 5 * time.Second},
+			headers: map[string]string{grpcTimeoutHeader: "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid x-request-timeout",
+			conf:    TimeoutConfig{Default: 5 * time.Second},
+			headers: map[string]string{requestTimeoutHeader: "-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/users", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got, err := newTimeoutPolicy(tt.conf).resolve(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
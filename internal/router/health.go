@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"log"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startHealthCheck 启动实例的主动健康检查 配置关闭时不做任何事
+// 健康状态变化时刷新服务池的可选实例
+func (pool *ServicePool) startHealthCheck(u *Upstream, conf HealthCheckConfig) {
+	if conf.Interval <= 0 {
+		return
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = conf.Interval
+	}
+	conf.UnhealthyThreshold = max(conf.UnhealthyThreshold, 1)
+	conf.HealthyThreshold = max(conf.HealthyThreshold, 1)
+	stop := make(chan struct{})
+	u.stopHealth = stop
+	go pool.runHealthCheck(u, conf, stop)
+}
+
+// stopHealthCheck 停止实例的健康检查 并将实例恢复为健康(未探测)状态
+// 调用方持有 pool.mu 写锁 不等待探测协程退出 协程在加锁后检查停止信号
+func (u *Upstream) stopHealthCheck() {
+	if u.stopHealth != nil {
+		close(u.stopHealth)
+		u.stopHealth = nil
+	}
+	u.healthy.Store(true)
+}
+
+func (pool *ServicePool) runHealthCheck(u *Upstream, conf HealthCheckConfig, stop <-chan struct{}) {
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+
+	var successes, failures int
+	for {
+		ok, reason := probe(u, conf)
+		if ok {
+			successes, failures = successes+1, 0
+			if !u.healthy.Load() && successes >= conf.HealthyThreshold && pool.setHealth(u, true, stop) {
+				log.Printf("Instance %s of service %s is healthy again", u.addr, pool.serviceName)
+			}
+		} else {
+			successes, failures = 0, failures+1
+			if u.healthy.Load() && failures >= conf.UnhealthyThreshold && pool.setHealth(u, false, stop) {
+				log.Printf("Warning: instance %s of service %s marked unhealthy after %d failed checks: %s", u.addr, pool.serviceName, failures, reason)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setHealth 更新实例健康状态并刷新可选实例 探测已停止时不做修改
+func (pool *ServicePool) setHealth(u *Upstream, healthy bool, stop <-chan struct{}) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	u.healthy.Store(healthy)
+	pool.refreshLocked()
+	return true
+}
+
+// probe 执行一次健康探测 返回是否健康及失败原因
+func probe(u *Upstream, conf HealthCheckConfig) (bool, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+	defer cancel()
+
+	status, err := u.invoker.CheckHealth(ctx, conf.Service)
+	if err != nil {
+		return false, err.Error()
+	}
+	if status != healthpb.HealthCheckResponse_SERVING {
+		return false, status.String()
+	}
+	return true, ""
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// RouteInfo 路由快照
+type RouteInfo struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"` // 路径模板 如 /v1/users/{id}
+	Service      string `json:"service"`
+	FullMethod   string `json:"full_method"`
+	Body         string `json:"body,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	// Streaming 流式类型 server(SSE / NDJSON) | client / bidi(WebSocket) 一元调用为空
+	Streaming string `json:"streaming,omitempty"`
+}
+
+func newRouteInfo(route *Route) RouteInfo {
+	info := RouteInfo{
+		Method:       route.HttpRule.Method,
+		Path:         route.HttpRule.Path,
+		Service:      route.ServiceName,
+		FullMethod:   route.FullMethod,
+		Body:         route.HttpRule.Body,
+		ResponseBody: route.HttpRule.ResponseBody,
+	}
+	switch md := route.MethodDesc; {
+	case md.IsClientStreaming() && md.IsServerStreaming():
+		info.Streaming = "bidi"
+	case md.IsClientStreaming():
+		info.Streaming = "client"
+	case md.IsServerStreaming():
+		info.Streaming = "server"
+	}
+	return info
+}
+
+// Routes 获取已注册的路由 按路径、方法排序 service 非空时仅返回该服务的路由
+func (r *HTTPRouter) Routes(service string) []RouteInfo {
+	r.mu.RLock()
+	out := make([]RouteInfo, 0)
+	for name, routes := range r.routeIndex {
+		if service != "" && name != service {
+			continue
+		}
+		for _, route := range routes {
+			out = append(out, newRouteInfo(route))
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(out, func(a, b RouteInfo) int {
+		return cmp.Or(cmp.Compare(a.Path, b.Path), cmp.Compare(a.Method, b.Method))
+	})
+	return out
+}
+
+// ServiceStatus 服务快照
+type ServiceStatus struct {
+	Name string `json:"name"`
+	// Version 描述符版本 Descriptor 为描述符集标识(服务@版本#摘要) 尚无描述符时为空
+	Version    string           `json:"version,omitempty"`
+	Descriptor string           `json:"descriptor,omitempty"`
+	Routes     int              `json:"routes"`
+	Instances  []InstanceStatus `json:"instances"`
+}
+
+// Services 获取所有服务的描述符版本、路由数与实例状态 按服务名排序
+func (r *HTTPRouter) Services() []ServiceStatus {
+	r.mu.RLock()
+	pools := maps.Clone(r.servicePools)
+	counts := make(map[string]int, len(r.routeIndex))
+	for name, routes := range r.routeIndex {
+		counts[name] = len(routes)
+	}
+	r.mu.RUnlock()
+
+	out := make([]ServiceStatus, 0, len(pools))
+	for name, pool := range pools {
+		s := ServiceStatus{Name: name, Routes: counts[name], Instances: pool.status()}
+		pool.mu.RLock()
+		if pool.descriptors != nil {
+			key := pool.descriptors.Key()
+			s.Version, s.Descriptor = key.Version, key.String()
+		}
+		pool.mu.RUnlock()
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b ServiceStatus) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return out
+}
+
+// MatchResult 路由匹配测试结果
+type MatchResult struct {
+	Matched    bool              `json:"matched"`
+	Route      *RouteInfo        `json:"route,omitempty"`
+	PathParams map[string]string `json:"path_params,omitempty"`
+	// Error 路径参数无法绑定时的错误 请求会以 400 拒绝
+	Error string `json:"error,omitempty"`
+	// AllowedMethods 未匹配时该路径上已注册的方法 为空表示路径不存在
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+}
+
+// Match 按请求处理时的规则测试 method + target 会命中的路由与路径参数
+// target 为请求路径 可带查询串 websocket 为 true 时按 WebSocket 握手优先匹配客户端流式方法
+func (r *HTTPRouter) Match(method, target string, websocket bool) (MatchResult, error) {
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return MatchResult{}, fmt.Errorf("invalid path %q: %w", target, err)
+	}
+	method = strings.ToUpper(strings.TrimSpace(method))
+	path := u.EscapedPath()
+
+	var (
+		route  *Route
+		params map[string]string
+		ok     bool
+	)
+	if websocket {
+		route, params, ok, err = r.matchWebSocket(path)
+	}
+	if !ok {
+		route, params, ok, err = r.match(method, path)
+	}
+	if !ok {
+		res := MatchResult{}
+		for _, m := range preflightMethods {
+			if _, _, found, _ := r.match(m, path); found {
+				res.AllowedMethods = append(res.AllowedMethods, m)
+			}
+		}
+		return res, nil
+	}
+	info := newRouteInfo(route)
+	res := MatchResult{Matched: true, Route: &info, PathParams: params}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res, nil
+}
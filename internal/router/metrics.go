@@ -0,0 +1,97 @@
+package router
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pilot/internal/metrics"
+	"pilot/internal/transcoder"
+
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// responseRecorder 记录响应状态码、匹配的路由与上游调用结果 供请求指标与访问日志使用
+// 实现 Hijack 与 Unwrap 以支持 WebSocket 与流式响应的 Flush
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64  // 已写出的响应体字节数
+	route    *Route // 匹配的路由 未匹配时为 nil
+	code     string // 上游调用的 gRPC 状态码 未调用上游时为空
+	upstream string // 处理请求的实例地址 未调用上游时为空
+
+	// 一元调用的请求/响应消息 供访问日志记录消息体
+	reqMsg   proto.Message
+	respMsg  proto.Message
+	resolver transcoder.TypeResolver
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// upstreamResult 记录处理请求的实例与上游调用结果
+func (w *responseRecorder) upstreamResult(u *Upstream, err error) {
+	w.code = status.Code(err).String()
+	if u != nil {
+		w.upstream = u.addr
+	}
+}
+
+// observe 记录请求数与耗时
+func (w *responseRecorder) observe(elapsed time.Duration) {
+	var route, service, method string
+	if w.route != nil {
+		route = routeTemplate(w.route)
+		service = w.route.ServiceName
+		method = w.route.FullMethod
+	}
+	code := w.status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	labels := []string{route, service, method, strconv.Itoa(code), w.code}
+	metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(elapsed.Seconds())
+}
+
+// routeTemplate 路由模板 如 GET /v1/users/{id}
+func routeTemplate(route *Route) string {
+	return route.HttpRule.Method + " " + route.HttpRule.Path
+}
+
+// observeUpstream 记录一次对实例的调用
+func (pool *ServicePool) observeUpstream(u *Upstream, err error) {
+	metrics.UpstreamRequests.WithLabelValues(pool.serviceName, u.addr).Inc()
+	if err != nil {
+		metrics.UpstreamErrors.WithLabelValues(pool.serviceName, u.addr, status.Code(err).String()).Inc()
+	}
+}
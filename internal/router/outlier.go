@@ -0,0 +1,195 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 被动异常检测
+// 一元调用结果计入实例的连续错误数与周期内成功/失败数
+// 连续错误达到阈值立即驱逐 周期分析时驱逐成功率显著低于其他实例的实例 并恢复驱逐到期的实例
+
+// isOutlierError 判断调用错误是否说明实例异常 业务错误(如 NotFound)视为实例正常响应
+func isOutlierError(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// report 记录一次一元调用结果 客户端取消的调用不计入
+func (pool *ServicePool) report(u *Upstream, err error) {
+	conf := pool.outlier.Load()
+	if conf == nil || !conf.enabled() {
+		return
+	}
+	if err != nil && (errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled) {
+		return
+	}
+	if err == nil || !isOutlierError(err) {
+		u.successes.Add(1)
+		u.consecutiveErrors.Store(0)
+		return
+	}
+
+	u.failures.Add(1)
+	n := u.consecutiveErrors.Add(1)
+	if conf.ConsecutiveErrors > 0 && n >= int64(conf.ConsecutiveErrors) {
+		pool.mu.Lock()
+		if d, ok := pool.ejectLocked(u, *conf, time.Now()); ok {
+			log.Printf("Warning: instance %s of service %s ejected for %s after %d consecutive errors: %v", u.addr, pool.serviceName, d, n, err)
+		}
+		pool.mu.Unlock()
+	}
+}
+
+// ejectLocked 驱逐实例并返回驱逐时长 超过最大驱逐比例时放弃 调用方持有 pool.mu 写锁
+// 比例按不可选实例计算 已被健康检查标记为不健康的实例同样计入
+func (pool *ServicePool) ejectLocked(u *Upstream, conf OutlierConfig, now time.Time) (time.Duration, bool) {
+	if u.ejectedUntil.Load() != 0 {
+		return 0, false
+	}
+	unavailable := 1 // 驱逐后的 u
+	for _, other := range pool.ordered {
+		if other != u && !other.available() {
+			unavailable++
+		}
+	}
+	if unavailable > maxEjections(len(pool.ordered), conf.MaxEjectionPercent) {
+		return 0, false
+	}
+
+	// 驱逐时长按驱逐次数指数增长
+	u.ejections++
+	d := conf.BaseEjectionTime * time.Duration(1<<min(u.ejections-1, 16))
+	if conf.MaxEjectionTime > 0 && d > conf.MaxEjectionTime {
+		d = conf.MaxEjectionTime
+	}
+	u.ejectedUntil.Store(now.Add(d).UnixNano())
+	u.consecutiveErrors.Store(0)
+	pool.refreshLocked()
+	return d, true
+}
+
+// maxEjections 允许同时不可选的实例数 至少一个 且始终保留一个实例
+func maxEjections(n, percent int) int {
+	allowed := n * percent / 100
+	if allowed < 1 {
+		allowed = 1
+	}
+	return min(allowed, n-1)
+}
+
+// startOutlierDetection 启动周期分析 配置关闭时不做任何事
+// 调用方持有 pool.mu 写锁
+func (pool *ServicePool) startOutlierDetection(conf OutlierConfig) {
+	if !conf.enabled() {
+		return
+	}
+	stop := make(chan struct{})
+	pool.stopOutlier = stop
+	go pool.runOutlierDetection(conf, stop)
+}
+
+// stopOutlierDetection 停止周期分析并恢复所有被驱逐实例 调用方持有 pool.mu 写锁
+func (pool *ServicePool) stopOutlierDetection() {
+	if pool.stopOutlier != nil {
+		close(pool.stopOutlier)
+		pool.stopOutlier = nil
+	}
+	for _, u := range pool.upstreams {
+		u.ejectedUntil.Store(0)
+		u.ejections = 0
+	}
+}
+
+func (pool *ServicePool) runOutlierDetection(conf OutlierConfig, stop <-chan struct{}) {
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			pool.analyze(conf, stop)
+		}
+	}
+}
+
+// analyze 周期分析 恢复到期实例、按成功率驱逐异常实例并重置周期计数
+func (pool *ServicePool) analyze(conf OutlierConfig, stop <-chan struct{}) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	now := time.Now()
+	returned := false
+	for _, u := range pool.ordered {
+		until := u.ejectedUntil.Load()
+		switch {
+		case until != 0 && now.UnixNano() >= until:
+			u.ejectedUntil.Store(0)
+			returned = true
+			log.Printf("Instance %s of service %s returned from ejection", u.addr, pool.serviceName)
+		case until == 0 && u.ejections > 0:
+			// 一个周期内未被驱逐 驱逐倍数逐步回落
+			u.ejections--
+		}
+	}
+
+	// 成功率分析
+	type sample struct {
+		u    *Upstream
+		rate float64
+	}
+	samples := make([]sample, 0, len(pool.ordered))
+	for _, u := range pool.ordered {
+		succ, fail := u.successes.Swap(0), u.failures.Swap(0)
+		total := succ + fail
+		if u.ejectedUntil.Load() != 0 || total == 0 || total < int64(conf.SuccessRateRequestVolume) {
+			continue
+		}
+		samples = append(samples, sample{u: u, rate: float64(succ) / float64(total)})
+	}
+	if conf.SuccessRateStdevFactor > 0 && len(samples) > 0 && len(samples) >= conf.SuccessRateMinHosts {
+		var sum float64
+		for _, s := range samples {
+			sum += s.rate
+		}
+		mean := sum / float64(len(samples))
+		var variance float64
+		for _, s := range samples {
+			variance += (s.rate - mean) * (s.rate - mean)
+		}
+		stdev := math.Sqrt(variance / float64(len(samples)))
+		threshold := mean - conf.SuccessRateStdevFactor*stdev
+		for _, s := range samples {
+			if s.rate >= threshold {
+				continue
+			}
+			if d, ok := pool.ejectLocked(s.u, conf, now); ok {
+				log.Printf("Warning: instance %s of service %s ejected for %s due to low success rate %.2f (mean %.2f, threshold %.2f)", s.u.addr, pool.serviceName, d, s.rate, mean, threshold)
+			}
+		}
+	}
+
+	// 驱逐时已刷新 仅在有实例恢复时刷新 避免每个周期重建负载均衡器状态
+	if returned {
+		pool.refreshLocked()
+	}
+}
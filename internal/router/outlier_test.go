@@ -0,0 +1,70 @@
+package router
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestPool 创建含给定实例的服务池 不启动健康检查与异常检测
+func newTestPool(ups []*Upstream) *ServicePool {
+	pool := newServicePool("demo")
+	for _, u := range ups {
+		pool.upstreams[u.addr] = u
+	}
+	pool.ordered = ups
+	pool.refreshLocked()
+	return pool
+}
+
+func TestEjectCountsUnhealthyInstances(t *testing.T) {
+	conf := OutlierConfig{BaseEjectionTime: time.Minute, MaxEjectionPercent: 50}
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		unhealthy []int // 健康检查不通过的实例下标
+		ejected   []int // 已驱逐的实例下标
+		eject     int
+		want      bool
+	}{
+		{name: "within cap", eject: 0, want: true},
+		{name: "one ejected", ejected: []int{0}, eject: 1, want: true},
+		{name: "cap reached by ejections", ejected: []int{0, 1}, eject: 2, want: false},
+		{name: "cap reached by unhealthy", unhealthy: []int{0, 1}, eject: 2, want: false},
+		{name: "cap reached by mixed", unhealthy: []int{0}, ejected: []int{1}, eject: 2, want: false},
+		{name: "ejecting unhealthy instance", unhealthy: []int{0, 1}, eject: 1, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ups := newTestUpstreams(4)
+			for _, i := range tt.unhealthy {
+				ups[i].healthy.Store(false)
+			}
+			for _, i := range tt.ejected {
+				ups[i].ejectedUntil.Store(now.Add(time.Minute).UnixNano())
+			}
+			pool := newTestPool(ups)
+
+			_, ok := pool.ejectLocked(ups[tt.eject], conf, now)
+			if ok != tt.want {
+				t.Fatalf("ejectLocked() = %v, want %v", ok, tt.want)
+			}
+			if len(pool.available) == 0 {
+				t.Fatal("no available instances left")
+			}
+		})
+	}
+}
+
+func TestEjectKeepsLastInstance(t *testing.T) {
+	ups := newTestUpstreams(2)
+	ups[0].healthy.Store(false)
+	pool := newTestPool(ups)
+	conf := OutlierConfig{BaseEjectionTime: time.Minute, MaxEjectionPercent: 100}
+	if _, ok := pool.ejectLocked(ups[1], conf, time.Now()); ok {
+		t.Fatal("ejected the only available instance")
+	}
+	if len(pool.available) != 1 || pool.available[0] != ups[1] {
+		t.Fatalf("available = %v, want [%s]", pool.available, ups[1].addr)
+	}
+}
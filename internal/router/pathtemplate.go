@@ -0,0 +1,105 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"pilot/internal/transcoder"
+)
+
+// compileTemplate 将路径模板编译为路由树路径
+// 字面量段保持原样 * 编译为 :{段下标} ** 编译为 *{段下标}
+// 参数以段下标命名 同层参数名恒定 避免不同模板间的参数名冲突
+func compileTemplate(tpl *transcoder.PathTemplate) string {
+	if len(tpl.Segments) == 0 {
+		return "/"
+	}
+	var b strings.Builder
+	for i, seg := range tpl.Segments {
+		b.WriteByte('/')
+		switch seg.Kind {
+		case transcoder.SegmentWildcard:
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(i))
+		case transcoder.SegmentDeepWildcard:
+			b.WriteByte('*')
+			b.WriteString(strconv.Itoa(i))
+		default:
+			b.WriteString(seg.Literal)
+		}
+	}
+	return b.String()
+}
+
+// routeKey 生成路由的注册键
+func routeKey(rule *transcoder.HTTPRule) string {
+	return normalizePath(rule.Method, rule.Template.Verb, compileTemplate(rule.Template))
+}
+
+// bindPathParams 将路由树捕获的段值按模板变量组装为 字段路径 -> 值
+func bindPathParams(tpl *transcoder.PathTemplate, captured map[string]string) (map[string]string, error) {
+	if len(tpl.Variables) == 0 {
+		return nil, nil
+	}
+
+	values := make([]string, len(tpl.Segments))
+	for i, seg := range tpl.Segments {
+		if seg.Kind == transcoder.SegmentLiteral {
+			values[i] = seg.Literal
+			continue
+		}
+		values[i] = captured[strconv.Itoa(i)]
+	}
+
+	params := make(map[string]string, len(tpl.Variables))
+	for _, v := range tpl.Variables {
+		raw := strings.Join(values[v.Start:v.End], "/")
+		// 单段变量完全解码 多段变量保留 %2F 以免与分隔符混淆
+		multiSegment := v.End-v.Start > 1 || tpl.Segments[v.Start].Kind == transcoder.SegmentDeepWildcard
+		value, err := unescapePathValue(raw, multiSegment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path parameter %s: %w", v.FieldPath, err)
+		}
+		params[v.FieldPath] = value
+	}
+	return params, nil
+}
+
+// unescapePathValue 解码路径参数值
+func unescapePathValue(raw string, keepSlash bool) (string, error) {
+	if !keepSlash {
+		return url.PathUnescape(raw)
+	}
+	parts := strings.Split(strings.ReplaceAll(raw, "%2f", "%2F"), "%2F")
+	for i, part := range parts {
+		v, err := url.PathUnescape(part)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = v
+	}
+	return strings.Join(parts, "%2F"), nil
+}
+
+// match 按 HTTP 方法与转义后的路径匹配路由 返回路由与绑定后的字段参数
+// 路径末段包含 ':' 时优先尝试按自定义动词匹配 失败后按普通路径匹配
+func (r *HTTPRouter) match(method, escapedPath string) (*Route, map[string]string, bool, error) {
+	lastSeg := escapedPath[strings.LastIndexByte(escapedPath, '/')+1:]
+	if idx := strings.LastIndexByte(lastSeg, ':'); idx >= 0 {
+		verb := lastSeg[idx+1:]
+		trimmed := escapedPath[:len(escapedPath)-len(verb)-1]
+		if route, captured, ok := r.routerTree.Lookup(normalizePath(method, verb, trimmed)); ok && route != nil {
+			params, err := bindPathParams(route.HttpRule.Template, captured)
+			return route, params, true, err
+		}
+	}
+
+	route, captured, ok := r.routerTree.Lookup(normalizePath(method, "", escapedPath))
+	if !ok || route == nil {
+		return nil, nil, false, nil
+	}
+	params, err := bindPathParams(route.HttpRule.Template, captured)
+	return route, params, true, err
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"maps"
+	"testing"
+
+	"pilot/internal/transcoder"
+)
+
+func mustTemplate(t *testing.T, template string) *transcoder.PathTemplate {
+	t.Helper()
+	tpl, err := transcoder.ParsePathTemplate(template)
+	if err != nil {
+		t.Fatalf("ParsePathTemplate(%q) error = %v", template, err)
+	}
+	return tpl
+}
+
+func TestCompileTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"/", "/"},
+		{"/v1/users", "/v1/users"},
+		{"/v1/users/{id}", "/v1/users/:2"},
+		{"/v1/users/{id}:activate", "/v1/users/:2"},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/:2/books/:4"},
+		{"/v1/{book.name=shelves/*}/pages/{page}", "/v1/shelves/:2/pages/:4"},
+		{"/v1/files/{path=**}", "/v1/files/*2"},
+		{"/v1/*/items/**", "/v1/:1/items/*3"},
+	}
+	for _, tt := range tests {
+		if got := compileTemplate(mustTemplate(t, tt.template)); got != tt.want {
+			t.Errorf("compileTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestRouteKey(t *testing.T) {
+	plain := &transcoder.HTTPRule{Method: "get", Path: "/v1/users/{id}", Template: mustTemplate(t, "/v1/users/{id}")}
+	verb := &transcoder.HTTPRule{Method: "POST", Path: "/v1/users/{id}:activate", Template: mustTemplate(t, "/v1/users/{id}:activate")}
+	if got, want := routeKey(plain), "/[GET]/v1/users/:2"; got != want {
+		t.Errorf("routeKey(plain) = %q, want %q", got, want)
+	}
+	if got, want := routeKey(verb), "/[POST:activate]/v1/users/:2"; got != want {
+		t.Errorf("routeKey(verb) = %q, want %q", got, want)
+	}
+}
+
+func TestBindPathParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		captured map[string]string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "no variables",
+			template: "/v1/users",
+		},
+		{
+			name:     "single segment",
+			template: "/v1/users/{id}",
+			captured: map[string]string{"2": "42"},
+			want:     map[string]string{"id": "42"},
+		},
+		{
+			name:     "single segment fully unescaped",
+			template: "/v1/users/{id}",
+			captured: map[string]string{"2": "a%2Fb%20c"},
+			want:     map[string]string{"id": "a/b c"},
+		},
+		{
+			name:     "multi segment with literals",
+			template: "/v1/{name=shelves/*/books/*}",
+			captured: map[string]string{"2": "s1", "4": "b%201"},
+			want:     map[string]string{"name": "shelves/s1/books/b 1"},
+		},
+		{
+			name:     "multi segment keeps escaped slash",
+			template: "/v1/{name=shelves/*/books/*}",
+			captured: map[string]string{"2": "s%2F1", "4": "b%2f2"},
+			want:     map[string]string{"name": "shelves/s%2F1/books/b%2F2"},
+		},
+		{
+			name:     "deep wildcard keeps escaped slash",
+			template: "/v1/files/{path=**}",
+			captured: map[string]string{"2": "a/b%2Fc/d%20e"},
+			want:     map[string]string{"path": "a/b%2Fc/d e"},
+		},
+		{
+			name:     "nested field paths",
+			template: "/v1/{book.name=shelves/*}/pages/{page.number}",
+			captured: map[string]string{"2": "s1", "4": "3"},
+			want:     map[string]string{"book.name": "shelves/s1", "page.number": "3"},
+		},
+		{
+			name:     "invalid escape",
+			template: "/v1/users/{id}",
+			captured: map[string]string{"2": "%zz"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid escape in multi segment",
+			template: "/v1/files/{path=**}",
+			captured: map[string]string{"2": "a/%zz"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindPathParams(mustTemplate(t, tt.template), tt.captured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bindPathParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("bindPathParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTemplateRouter 创建仅含给定路由的路由器 routes 为 HTTP 方法 -> 路径模板
+func newTemplateRouter(t *testing.T, routes [][2]string) *HTTPRouter {
+	t.Helper()
+	r := NewHTTPRouter(DefaultConfig(), CORSConfig{}, nil, GlobalRateLimitConfig{}, nil)
+	set := make(map[string]*Route, len(routes))
+	for _, rt := range routes {
+		rule := &transcoder.HTTPRule{Method: rt[0], Path: rt[1], Template: mustTemplate(t, rt[1])}
+		set[routeKey(rule)] = &Route{ServiceName: "demo", FullMethod: rt[0] + " " + rt[1], HttpRule: rule}
+	}
+	r.syncRoutes("demo", set)
+	if got := len(r.routeIndex["demo"]); got != len(routes) {
+		t.Fatalf("registered %d routes, want %d", got, len(routes))
+	}
+	return r
+}
+
+func TestMatch(t *testing.T) {
+	r := newTemplateRouter(t, [][2]string{
+		{"GET", "/v1/users/{id}"},
+		{"GET", "/v1/users/me"},
+		{"GET", "/v1/users/{id}:activate"},
+		{"POST", "/v1/users/{id}:activate"},
+		{"GET", "/v1/{book.name=shelves/*}/pages/{page}"},
+		{"GET", "/v1/files/{path=**}"},
+		{"GET", "/:status"},
+	})
+
+	tests := []struct {
+		method  string
+		path    string
+		want    string // 命中路由的 FullMethod 为空表示不匹配
+		params  map[string]string
+		wantErr bool
+	}{
+		{method: "GET", path: "/v1/users/42", want: "GET /v1/users/{id}", params: map[string]string{"id": "42"}},
+		{method: "GET", path: "/v1/users/me", want: "GET /v1/users/me"},
+		{method: "GET", path: "/v1/users/42:activate", want: "GET /v1/users/{id}:activate", params: map[string]string{"id": "42"}},
+		{method: "POST", path: "/v1/users/42:activate", want: "POST /v1/users/{id}:activate", params: map[string]string{"id": "42"}},
+		// 未注册的动词回退为普通路径匹配 ':' 属于参数值
+		{method: "GET", path: "/v1/users/a:b", want: "GET /v1/users/{id}", params: map[string]string{"id": "a:b"}},
+		// 仅有动词路由时 无动词的请求不匹配
+		{method: "POST", path: "/v1/users/42"},
+		{method: "GET", path: "/v1/users/a%2Fb", want: "GET /v1/users/{id}", params: map[string]string{"id": "a/b"}},
+		{method: "GET", path: "/v1/shelves/s1/pages/3", want: "GET /v1/{book.name=shelves/*}/pages/{page}", params: map[string]string{"book.name": "shelves/s1", "page": "3"}},
+		{method: "GET", path: "/v1/files/a/b%2Fc/d", want: "GET /v1/files/{path=**}", params: map[string]string{"path": "a/b%2Fc/d"}},
+		{method: "GET", path: "/:status", want: "GET /:status"},
+		{method: "GET", path: "/v1/users/%zz", want: "GET /v1/users/{id}", wantErr: true},
+		{method: "DELETE", path: "/v1/users/42"},
+		{method: "GET", path: "/v2/users/42"},
+		{method: "GET", path: "/v1/users"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			route, params, ok, err := r.match(tt.method, tt.path)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("match() = %s, want no match", route.FullMethod)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("match() did not match, want %s", tt.want)
+			}
+			if route.FullMethod != tt.want {
+				t.Errorf("match() route = %s, want %s", route.FullMethod, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("match() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(params, tt.params) {
+				t.Errorf("match() params = %v, want %v", params, tt.params)
+			}
+		})
+	}
+}
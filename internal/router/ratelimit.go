@@ -0,0 +1,332 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 限流响应头 Limit 为桶容量 Remaining 为剩余令牌数 Reset 为令牌桶补满所需秒数
+const (
+	rateLimitLimitHeader     = "X-RateLimit-Limit"
+	rateLimitRemainingHeader = "X-RateLimit-Remaining"
+	rateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+const (
+	// rateLimitSweepInterval 清理已补满令牌桶的周期
+	rateLimitSweepInterval = time.Minute
+	// rateLimitMaxKeys 令牌桶数超过该值时提前清理
+	rateLimitMaxKeys = 100000
+)
+
+// GlobalRateLimitConfig 网关级限流配置
+type GlobalRateLimitConfig struct {
+	// TrustedProxies 可信代理的 IP 或 CIDR 来自可信代理的请求按 X-Forwarded-For 确定客户端 IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// RateLimitConfig 对全部路由生效的限流 同一限流键在所有路由间共享令牌桶
+	RateLimitConfig `mapstructure:",squash"`
+}
+
+// 限流键来源
+const (
+	rateLimitKeyClientIP = "client_ip"
+	rateLimitKeyHeader   = "header"
+	rateLimitKeyClaim    = "claim"
+	rateLimitKeyRoute    = "route"
+)
+
+// rateLimitKey 限流键 header / claim 缺失时退化为客户端 IP
+type rateLimitKey struct {
+	source string
+	name   string // 请求头名或声明名
+}
+
+// parseRateLimitKey 解析 client_ip | header:<name> | claim:<name> | route
+func parseRateLimitKey(scope, key string) rateLimitKey {
+	key = strings.TrimSpace(key)
+	source, name, _ := strings.Cut(key, ":")
+	name = strings.TrimSpace(name)
+	switch {
+	case key == "" || key == rateLimitKeyClientIP:
+		return rateLimitKey{source: rateLimitKeyClientIP}
+	case key == rateLimitKeyRoute:
+		return rateLimitKey{source: rateLimitKeyRoute}
+	case source == rateLimitKeyHeader && name != "":
+		return rateLimitKey{source: rateLimitKeyHeader, name: http.CanonicalHeaderKey(name)}
+	case source == rateLimitKeyClaim && name != "":
+		return rateLimitKey{source: rateLimitKeyClaim, name: name}
+	}
+	log.Printf("Warning: invalid rate limit key %q for %s, falling back to client_ip", key, scope)
+	return rateLimitKey{source: rateLimitKeyClientIP}
+}
+
+// value 计算请求的限流键 不同来源的键带前缀以免相互冲突
+func (k rateLimitKey) value(req *http.Request, route *Route, claims map[string]any, clientIP func() string) string {
+	switch k.source {
+	case rateLimitKeyRoute:
+		return "route:" + route.FullMethod
+	case rateLimitKeyHeader:
+		if v := req.Header.Get(k.name); v != "" {
+			return "header:" + v
+		}
+	case rateLimitKeyClaim:
+		if v, ok := claims[k.name]; ok {
+			return "claim:" + fmt.Sprint(v)
+		}
+	}
+	return "ip:" + clientIP()
+}
+
+// credentialHeader 限流键取自请求头(如 API Key)时返回请求头名 否则返回空串
+func (l *rateLimiter) credentialHeader() string {
+	if l == nil || l.key.source != rateLimitKeyHeader {
+		return ""
+	}
+	return l.key.name
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 按限流键维护令牌桶
+type rateLimiter struct {
+	rate    float64 // 每秒补充的令牌数
+	burst   float64 // 桶容量
+	key     rateLimitKey
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// newRateLimiter 创建限流器 未开启限流时返回 nil
+func newRateLimiter(scope string, conf RateLimitConfig) *rateLimiter {
+	if !conf.enabled() {
+		return nil
+	}
+	burst := float64(conf.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(conf.Rate)
+	}
+	return &rateLimiter{
+		rate:    conf.Rate,
+		burst:   burst,
+		key:     parseRateLimitKey(scope, conf.Key),
+		buckets: make(map[string]*tokenBucket),
+		swept:   time.Now(),
+	}
+}
+
+// rateLimitResult 单次限流判断结果
+type rateLimitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // 令牌桶补满所需时间
+	retryAfter time.Duration // 被拒绝时获得下一个令牌所需时间
+}
+
+// take 从 key 对应的令牌桶中取一个令牌
+func (l *rateLimiter) take(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		l.sweepLocked(now)
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else if now.After(b.last) {
+		b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+		b.last = now
+	}
+
+	res := rateLimitResult{limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.allowed = true
+	} else {
+		res.retryAfter = l.refillTime(1 - b.tokens)
+	}
+	res.remaining = int(b.tokens)
+	res.reset = l.refillTime(l.burst - b.tokens)
+	return res
+}
+
+// refund 归还 take 取走的令牌
+func (l *rateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = min(l.burst, b.tokens+1)
+	}
+}
+
+// refillTime 补充 tokens 个令牌所需时间
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweepLocked 定期清理已补满的令牌桶 补满的桶与新建的桶等价 调用方持有 l.mu
+// 令牌桶数超过上限时提前清理 但至少间隔 1s 以免每次新建都遍历
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	elapsed := now.Sub(l.swept)
+	if elapsed < rateLimitSweepInterval && (len(l.buckets) < rateLimitMaxKeys || elapsed < time.Second) {
+		return
+	}
+	l.swept = now
+	full := l.refillTime(l.burst)
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// admit 依次检查全局限流与路由限流 任一拒绝时不消耗令牌 输出剩余令牌最少的限流头 被拒绝时输出 429 与 Retry-After
+func (r *HTTPRouter) admit(w http.ResponseWriter, req *http.Request, route *Route, limiter *rateLimiter, claims map[string]any) bool {
+	if r.limiter == nil && limiter == nil {
+		return true
+	}
+	var ip string
+	clientIP := func() string {
+		if ip == "" {
+			ip = r.clientIP.resolve(req)
+		}
+		return ip
+	}
+
+	var (
+		result   rateLimitResult
+		found    bool
+		taken    *rateLimiter // 已取走令牌的全局限流器
+		takenKey string
+		global   bool // 是否被全局限流拒绝
+	)
+	now := time.Now()
+	for _, l := range [...]*rateLimiter{r.limiter, limiter} {
+		if l == nil {
+			continue
+		}
+		key := l.key.value(req, route, claims, clientIP)
+		res := l.take(key, now)
+		if !found || !res.allowed || res.remaining < result.remaining {
+			result, found = res, true
+		}
+		if !res.allowed {
+			global = l == r.limiter
+			// 被路由限流拒绝的请求不消耗全局令牌
+			if taken != nil {
+				taken.refund(takenKey)
+			}
+			break
+		}
+		taken, takenKey = l, key
+	}
+
+	h := w.Header()
+	h.Set(rateLimitLimitHeader, strconv.Itoa(result.limit))
+	h.Set(rateLimitRemainingHeader, strconv.Itoa(result.remaining))
+	h.Set(rateLimitResetHeader, strconv.Itoa(int(math.Ceil(result.reset.Seconds()))))
+	if result.allowed {
+		return true
+	}
+	retryAfter := max(int(math.Ceil(result.retryAfter.Seconds())), 1)
+	h.Set("Retry-After", strconv.Itoa(retryAfter))
+	msg := fmt.Sprintf("Rate limit exceeded for %s, retry after %ds", route.FullMethod, retryAfter)
+	if global {
+		msg = fmt.Sprintf("Global rate limit exceeded, retry after %ds", retryAfter)
+	}
+	writeJSON(w, http.StatusTooManyRequests, Result{
+		Code: http.StatusTooManyRequests,
+		Msg:  msg,
+		Data: nil,
+	})
+	return false
+}
+
+// clientIPResolver 解析客户端 IP
+// 直连地址为可信代理时 按 X-Forwarded-For 从右向左取第一个非可信代理的地址
+type clientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+func newClientIPResolver(proxies []string) clientIPResolver {
+	var c clientIPResolver
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				log.Printf("Warning: invalid trusted proxy %q: %v", p, err)
+				continue
+			}
+			addr = addr.Unmap()
+			c.trusted = append(c.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			log.Printf("Warning: invalid trusted proxy %q: %v", p, err)
+			continue
+		}
+		c.trusted = append(c.trusted, prefix.Masked())
+	}
+	return c
+}
+
+// isTrusted 地址是否属于可信代理
+func (c clientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range c.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve 请求的客户端 IP X-Forwarded-For 中出现非法地址时以其右侧最近的地址为准
+func (c clientIPResolver) resolve(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if len(c.trusted) == 0 || !c.isTrusted(addr) {
+		return addr.String()
+	}
+
+	var hops []string
+	for _, v := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !c.isTrusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
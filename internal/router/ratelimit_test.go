@@ -0,0 +1,53 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdmitRouteRejectionKeepsGlobalToken(t *testing.T) {
+	global := GlobalRateLimitConfig{RateLimitConfig: RateLimitConfig{Rate: 0.001, Burst: 2}}
+	r := NewHTTPRouter(DefaultConfig(), CORSConfig{}, nil, global, nil)
+	limited := &Route{FullMethod: "/demo.v1.UserService/GetUser"}
+	unlimited := &Route{FullMethod: "/demo.v1.UserService/ListUsers"}
+	routeLimiter := newRateLimiter(limited.FullMethod, RateLimitConfig{Rate: 0.001, Burst: 1})
+
+	steps := []struct {
+		route   *Route
+		limiter *rateLimiter
+		want    int
+		wantMsg string // 被拒绝时响应消息的前缀
+	}{
+		{route: limited, limiter: routeLimiter, want: http.StatusOK},
+		// 路由限流拒绝 全局令牌归还
+		{route: limited, limiter: routeLimiter, want: http.StatusTooManyRequests, wantMsg: "Rate limit exceeded for /demo.v1.UserService/GetUser"},
+		{route: unlimited, want: http.StatusOK},
+		{route: unlimited, want: http.StatusTooManyRequests, wantMsg: "Global rate limit exceeded"},
+		// 全局限流先于路由限流拒绝
+		{route: limited, limiter: routeLimiter, want: http.StatusTooManyRequests, wantMsg: "Global rate limit exceeded"},
+	}
+	for i, step := range steps {
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+		w := httptest.NewRecorder()
+		got := http.StatusOK
+		if !r.admit(w, req, step.route, step.limiter, nil) {
+			got = w.Code
+		}
+		if got != step.want {
+			t.Fatalf("request %d to %s: status %d, want %d", i, step.route.FullMethod, got, step.want)
+		}
+		if step.wantMsg == "" {
+			continue
+		}
+		var res Result
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("request %d: invalid response %q: %v", i, w.Body.String(), err)
+		}
+		if !strings.HasPrefix(res.Msg, step.wantMsg) {
+			t.Errorf("request %d: message %q, want prefix %q", i, res.Msg, step.wantMsg)
+		}
+	}
+}
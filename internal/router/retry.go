@@ -0,0 +1,290 @@
+package router
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// attemptsHeader 响应头 本次请求对上游发起的尝试次数(含重试与对冲)
+const attemptsHeader = "X-Pilot-Attempts"
+
+// idempotentMethods 默认视为幂等、允许重试的 HTTP 方法
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryPolicy 单个路由的最终重试策略
+type retryPolicy struct {
+	maxAttempts   int
+	retryOn       []codes.Code
+	perTryTimeout time.Duration
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	hedgeDelay    time.Duration
+}
+
+// newRetryPolicy 由路由配置生成重试策略 非幂等路由不重试 对冲仅用于 GET 路由
+func newRetryPolicy(serviceName string, route *Route, conf RetryConfig) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:   max(conf.MaxAttempts, 1),
+		retryOn:       parseCodes(serviceName, conf.RetryOn),
+		perTryTimeout: conf.PerTryTimeout,
+		backoffBase:   conf.BackoffBase,
+		backoffMax:    conf.BackoffMax,
+	}
+	method := route.HttpRule.Method
+	idempotent := idempotentMethods[method]
+	if conf.Idempotent != nil {
+		idempotent = *conf.Idempotent
+	}
+	if !idempotent {
+		policy.maxAttempts = 1
+	}
+	if method == http.MethodGet {
+		policy.hedgeDelay = conf.HedgeDelay
+	}
+	return policy
+}
+
+// retryable 错误是否可以换实例重试 单次尝试超时(整体请求未超时)总是可重试
+func (p retryPolicy) retryable(ctx context.Context, err error) bool {
+	code := status.Code(err)
+	if code == codes.DeadlineExceeded && p.perTryTimeout > 0 && ctx.Err() == nil {
+		return true
+	}
+	return slices.Contains(p.retryOn, code)
+}
+
+// backoff 第 n 次重试前的等待时长 指数增长并带随机抖动
+func (p retryPolicy) backoff(n int) time.Duration {
+	if p.backoffBase <= 0 {
+		return 0
+	}
+	d := p.backoffBase << min(n-1, 16)
+	if p.backoffMax > 0 && d > p.backoffMax {
+		d = p.backoffMax
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseCodes 解析 gRPC 状态码名称 如 UNAVAILABLE 非法名称忽略并告警
+func parseCodes(serviceName string, names []string) []codes.Code {
+	out := make([]codes.Code, 0, len(names))
+	for _, name := range names {
+		var c codes.Code
+		if err := c.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(strings.TrimSpace(name))))); err != nil {
+			log.Printf("Warning: invalid retry status code %q for service %s", name, serviceName)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// attemptResult 一次尝试的结果
+type attemptResult struct {
+	upstream *Upstream
+	resp     proto.Message
+	err      error
+}
+
+// invokeUnary 按重试策略发起一元调用
+// 可重试错误换实例重试(退避后) 开启对冲时首个尝试在对冲延迟内未返回则向其他实例并发发起
+// 首个成功或不可重试的结果胜出 其余尝试被取消 返回结果、产生结果的实例与尝试次数
+func (pool *ServicePool) invokeUnary(ctx context.Context, req *http.Request, pathParams map[string]string, method protoreflect.MethodDescriptor, reqMsg proto.Message, policy retryPolicy, first *Upstream) (proto.Message, *Upstream, int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, policy.maxAttempts)
+	tried := make([]*Upstream, 0, policy.maxAttempts)
+	launch := func(u *Upstream) {
+		tried = append(tried, u)
+		go func() {
+			resp, err := pool.attempt(ctx, u, method, reqMsg, policy.perTryTimeout)
+			results <- attemptResult{upstream: u, resp: resp, err: err}
+		}()
+	}
+	budget := pool.retryBudget()
+	budget.deposit()
+	// next 选择尚未尝试过的实例发起下一次尝试 受重试预算限制
+	next := func() bool {
+		if len(tried) >= policy.maxAttempts || ctx.Err() != nil || !budget.withdraw() {
+			return false
+		}
+		u, err := pool.pick(req, pathParams, tried...)
+		if err != nil {
+			return false
+		}
+		launch(u)
+		return true
+	}
+
+	var hedgeC, retryC <-chan time.Time
+	// armHedge 仍可发起尝试时启动下一次对冲计时
+	armHedge := func() {
+		hedgeC = nil
+		if policy.hedgeDelay > 0 && len(tried) < policy.maxAttempts {
+			hedgeC = time.After(policy.hedgeDelay)
+		}
+	}
+
+	launch(first)
+	inflight := 1
+	armHedge()
+
+	var last attemptResult
+	done := ctx.Done()
+	for inflight > 0 || retryC != nil {
+		select {
+		case <-done:
+			// 请求已取消 不再发起新的尝试 等待进行中的尝试退出
+			done, hedgeC, retryC = nil, nil, nil
+		case <-hedgeC:
+			hedgeC = nil
+			if next() {
+				inflight++
+				armHedge()
+			}
+		case <-retryC:
+			retryC = nil
+			if next() {
+				inflight++
+				armHedge()
+			}
+		case res := <-results:
+			inflight--
+			if res.err != nil && ctx.Err() != nil {
+				return nil, res.upstream, len(tried), status.FromContextError(ctx.Err()).Err()
+			}
+			if res.err == nil || !policy.retryable(ctx, res.err) {
+				return res.resp, res.upstream, len(tried), res.err
+			}
+			last = res
+			// 仍有对冲中的尝试时等待其结果 否则退避后重试
+			if inflight == 0 && len(tried) < policy.maxAttempts {
+				hedgeC = nil
+				retryC = time.After(policy.backoff(len(tried)))
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, last.upstream, len(tried), status.FromContextError(ctx.Err()).Err()
+	}
+	return last.resp, last.upstream, len(tried), last.err
+}
+
+// attempt 对单个实例发起一次调用 记录实例延迟与异常检测结果
+func (pool *ServicePool) attempt(ctx context.Context, u *Upstream, method protoreflect.MethodDescriptor, reqMsg proto.Message, perTryTimeout time.Duration) (proto.Message, error) {
+	u.acquire()
+	defer u.release()
+
+	if perTryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, perTryTimeout)
+		defer cancel()
+	}
+	ctx, span := startClientSpan(ctx, string(method.Parent().FullName())+"/"+string(method.Name()), u.addr)
+	start := time.Now()
+	resp, err := u.invoker.Invoke(ctx, method, reqMsg)
+	u.observe(time.Since(start))
+	pool.report(u, err)
+	pool.observeUpstream(u, err)
+	endClientSpan(span, err)
+	return resp, err
+}
+
+// retryBudget 重试预算 滑动窗口内重试数不超过请求数的一定比例(且保留每秒最少重试数)
+type retryBudget struct {
+	percent      float64
+	minPerSecond int
+	now          func() time.Time // 时钟 默认 time.Now
+
+	mu          sync.Mutex
+	requests    [breakerBuckets]int
+	retries     [breakerBuckets]int
+	bucketIdx   int
+	bucketStart time.Time
+}
+
+// retryBudget 获取服务池当前的重试预算
+func (pool *ServicePool) retryBudget() *retryBudget {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	if pool.budget == nil {
+		return newRetryBudget(0, 0)
+	}
+	return pool.budget
+}
+
+// retryBudgetWindow 重试预算统计窗口
+const retryBudgetWindow = 10 * time.Second
+
+func newRetryBudget(percent float64, minPerSecond int) *retryBudget {
+	return &retryBudget{percent: percent, minPerSecond: minPerSecond, now: time.Now}
+}
+
+// deposit 记录一次请求
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(b.now())
+	b.requests[b.bucketIdx]++
+}
+
+// withdraw 申请一次重试 预算不足时返回 false
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(b.now())
+
+	var requests, retries int
+	for i := range breakerBuckets {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+	allowed := max(int(float64(requests)*b.percent/100), b.minPerSecond*int(retryBudgetWindow/time.Second))
+	if retries >= allowed {
+		return false
+	}
+	b.retries[b.bucketIdx]++
+	return true
+}
+
+func (b *retryBudget) rotate(now time.Time) {
+	width := retryBudgetWindow / breakerBuckets
+	if b.bucketStart.IsZero() {
+		b.bucketStart = now
+		return
+	}
+	steps := int(now.Sub(b.bucketStart) / width)
+	if steps <= 0 {
+		return
+	}
+	if steps >= breakerBuckets {
+		b.requests, b.retries = [breakerBuckets]int{}, [breakerBuckets]int{}
+		b.bucketIdx = 0
+		b.bucketStart = now
+		return
+	}
+	for range steps {
+		b.bucketIdx = (b.bucketIdx + 1) % breakerBuckets
+		b.requests[b.bucketIdx], b.retries[b.bucketIdx] = 0, 0
+	}
+	b.bucketStart = b.bucketStart.Add(time.Duration(steps) * width)
+}
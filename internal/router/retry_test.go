@@ -0,0 +1,296 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"pilot/internal/transcoder"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func newTestBudget(clock *fakeClock, percent float64, minPerSecond int) *retryBudget {
+	b := newRetryBudget(percent, minPerSecond)
+	b.now = clock.Now
+	return b
+}
+
+// withdrawN 连续申请重试 返回成功次数
+func withdrawN(b *retryBudget, n int) int {
+	granted := 0
+	for range n {
+		if b.withdraw() {
+			granted++
+		}
+	}
+	return granted
+}
+
+func TestRetryBudgetPercent(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBudget(clock, 20, 0)
+	for range 10 {
+		b.deposit()
+	}
+	if got := withdrawN(b, 5); got != 2 {
+		t.Fatalf("granted %d retries for 10 requests at 20%%, want 2", got)
+	}
+	// 新的请求补充预算
+	for range 5 {
+		b.deposit()
+	}
+	if got := withdrawN(b, 5); got != 1 {
+		t.Fatalf("granted %d retries after 5 more requests, want 1", got)
+	}
+}
+
+func TestRetryBudgetMinPerSecond(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBudget(clock, 20, 1)
+	// 低流量时窗口内至少允许 min_per_second * 10 次重试
+	if got := withdrawN(b, 20); got != 10 {
+		t.Fatalf("granted %d retries without requests, want 10", got)
+	}
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	clock := newFakeClock()
+	b := newTestBudget(clock, 50, 0)
+	for range 4 {
+		b.deposit()
+	}
+	if got := withdrawN(b, 4); got != 2 {
+		t.Fatalf("granted %d retries, want 2", got)
+	}
+
+	// 半个窗口后 之前的请求与重试仍计入
+	clock.Advance(5 * time.Second)
+	for range 2 {
+		b.deposit()
+	}
+	if got := withdrawN(b, 4); got != 1 {
+		t.Fatalf("granted %d retries half a window later, want 1", got)
+	}
+
+	// 最早的请求与重试移出窗口后 仅计入后半段的 2 个请求与 1 次重试
+	clock.Advance(5 * time.Second)
+	if got := withdrawN(b, 4); got != 0 {
+		t.Fatalf("granted %d retries after the first half expired, want 0", got)
+	}
+	clock.Advance(5 * time.Second)
+	for range 2 {
+		b.deposit()
+	}
+	if got := withdrawN(b, 4); got != 1 {
+		t.Fatalf("granted %d retries after the window expired, want 1", got)
+	}
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	b := newRetryBudget(0, 0)
+	b.deposit()
+	if b.withdraw() {
+		t.Fatal("withdraw() succeeded with an empty budget")
+	}
+}
+
+// echoProto 重试测试使用的服务定义
+const echoProto = `syntax = "proto3";
+package demo.v1;
+
+message Echo {
+  string from = 1;
+}
+
+service EchoService {
+  rpc Call(Echo) returns (Echo);
+}
+`
+
+// upstreamBehavior 测试实例的响应行为
+type upstreamBehavior struct {
+	delay time.Duration
+	code  codes.Code
+}
+
+// newTestEchoPool 为每个行为启动一个进程内 gRPC 服务端 并创建连接到它们的服务池
+// 服务端在响应的 from 字段中返回自身下标
+func newTestEchoPool(t *testing.T, behaviors ...upstreamBehavior) (*ServicePool, protoreflect.MethodDescriptor) {
+	t.Helper()
+	parser := protoparse.Parser{Accessor: protoparse.FileContentsFromMap(map[string]string{"echo.proto": echoProto})}
+	files, err := parser.ParseFiles("echo.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	method := files[0].FindService("demo.v1.EchoService").FindMethodByName("Call").UnwrapMethod()
+	fds := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(files[0].UnwrapFile())}}
+	set, err := transcoder.NewDescriptorRegistry().Acquire(transcoder.DescriptorKey{Service: "demo.v1.EchoService", Version: "test"}, fds)
+	if err != nil {
+		t.Fatalf("failed to acquire descriptors: %v", err)
+	}
+	defer set.Release()
+
+	ups := make([]*Upstream, 0, len(behaviors))
+	for i, behavior := range behaviors {
+		from := string(rune('0' + i))
+		srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			req := dynamicpb.NewMessage(method.Input())
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			select {
+			case <-time.After(behavior.delay):
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+			if behavior.code != codes.OK {
+				return status.Error(behavior.code, "upstream "+from)
+			}
+			resp := dynamicpb.NewMessage(method.Output())
+			resp.Set(method.Output().Fields().ByName("from"), protoreflect.ValueOfString(from))
+			return stream.SendMsg(resp)
+		}))
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+
+		inv, err := transcoder.NewGRPCInvoker(lis.Addr().String(), set, nil)
+		if err != nil {
+			t.Fatalf("failed to create invoker: %v", err)
+		}
+		t.Cleanup(func() { inv.Close() })
+		ups = append(ups, newUpstream(lis.Addr().String(), inv))
+	}
+	return newTestPool(ups), method
+}
+
+// invokeTest 以 ordered[0] 为首个实例发起一元调用 返回响应实例下标、尝试次数与耗时
+func invokeTest(t *testing.T, pool *ServicePool, method protoreflect.MethodDescriptor, policy retryPolicy) (string, int, time.Duration, error) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/v1/echo", nil)
+	start := time.Now()
+	resp, _, attempts, err := pool.invokeUnary(context.Background(), req, nil, method, dynamicpb.NewMessage(method.Input()), policy, pool.ordered[0])
+	elapsed := time.Since(start)
+	if err != nil {
+		return "", attempts, elapsed, err
+	}
+	from := resp.ProtoReflect().Get(method.Output().Fields().ByName("from")).String()
+	return from, attempts, elapsed, nil
+}
+
+func TestInvokeUnaryRetry(t *testing.T) {
+	retryPolicy := retryPolicy{maxAttempts: 3, retryOn: []codes.Code{codes.Unavailable}}
+
+	tests := []struct {
+		name      string
+		behaviors []upstreamBehavior
+		budget    *retryBudget
+		wantFrom  string
+		wantCode  codes.Code
+		attempts  int
+	}{
+		{
+			name:      "retry on another instance",
+			behaviors: []upstreamBehavior{{code: codes.Unavailable}, {}},
+			budget:    newRetryBudget(100, 10),
+			wantFrom:  "1",
+			attempts:  2,
+		},
+		{
+			name:      "non retryable code",
+			behaviors: []upstreamBehavior{{code: codes.NotFound}, {}},
+			budget:    newRetryBudget(100, 10),
+			wantCode:  codes.NotFound,
+			attempts:  1,
+		},
+		{
+			name:      "budget exhausted",
+			behaviors: []upstreamBehavior{{code: codes.Unavailable}, {}},
+			budget:    newRetryBudget(0, 0),
+			wantCode:  codes.Unavailable,
+			attempts:  1,
+		},
+		{
+			name:      "attempts exhausted",
+			behaviors: []upstreamBehavior{{code: codes.Unavailable}, {code: codes.Unavailable}, {code: codes.Unavailable}},
+			budget:    newRetryBudget(100, 10),
+			wantCode:  codes.Unavailable,
+			attempts:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, method := newTestEchoPool(t, tt.behaviors...)
+			pool.budget = tt.budget
+			from, attempts, _, err := invokeTest(t, pool, method, retryPolicy)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("invokeUnary() code = %s, want %s (err %v)", code, tt.wantCode, err)
+			}
+			if from != tt.wantFrom {
+				t.Errorf("response from upstream %q, want %q", from, tt.wantFrom)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestInvokeUnaryHedge(t *testing.T) {
+	const slow = 2 * time.Second
+	hedgePolicy := retryPolicy{maxAttempts: 2, hedgeDelay: 20 * time.Millisecond}
+
+	t.Run("hedged request wins", func(t *testing.T) {
+		pool, method := newTestEchoPool(t, upstreamBehavior{delay: slow}, upstreamBehavior{})
+		pool.budget = newRetryBudget(100, 10)
+		from, attempts, elapsed, err := invokeTest(t, pool, method, hedgePolicy)
+		if err != nil {
+			t.Fatalf("invokeUnary() error = %v", err)
+		}
+		if from != "1" || attempts != 2 {
+			t.Errorf("response from %q after %d attempts, want from 1 after 2", from, attempts)
+		}
+		if elapsed >= slow/2 {
+			t.Errorf("hedged call took %s, want well under %s", elapsed, slow)
+		}
+	})
+
+	t.Run("fast first attempt is not hedged", func(t *testing.T) {
+		pool, method := newTestEchoPool(t, upstreamBehavior{}, upstreamBehavior{})
+		pool.budget = newRetryBudget(100, 10)
+		policy := hedgePolicy
+		policy.hedgeDelay = time.Second
+		from, attempts, _, err := invokeTest(t, pool, method, policy)
+		if err != nil {
+			t.Fatalf("invokeUnary() error = %v", err)
+		}
+		if from != "0" || attempts != 1 {
+			t.Errorf("response from %q after %d attempts, want from 0 after 1", from, attempts)
+		}
+	})
+
+	t.Run("budget exhausted disables hedging", func(t *testing.T) {
+		pool, method := newTestEchoPool(t, upstreamBehavior{delay: 200 * time.Millisecond}, upstreamBehavior{})
+		pool.budget = newRetryBudget(0, 0)
+		from, attempts, _, err := invokeTest(t, pool, method, hedgePolicy)
+		if err != nil {
+			t.Fatalf("invokeUnary() error = %v", err)
+		}
+		if from != "0" || attempts != 1 {
+			t.Errorf("response from %q after %d attempts, want from 0 after 1", from, attempts)
+		}
+	})
+}
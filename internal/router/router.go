@@ -1,14 +1,19 @@
 package router
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"maps"
 	"strings"
 	"sync"
 
+	"pilot/internal/accesslog"
+	"pilot/internal/auth"
 	"pilot/internal/discovery"
 	"pilot/internal/transcoder"
+	gatewayv1 "pilot/proto/pilot/gateway/v1"
 
 	"github.com/jhump/protoreflect/desc"
 )
@@ -20,28 +25,47 @@ type Route struct {
 	FullMethod  string
 	MethodDesc  *desc.MethodDescriptor
 	HttpRule    *transcoder.HTTPRule
+	Policy      *gatewayv1.Policy // proto 中声明的网关策略 未声明时为 nil
 }
 
 // HTTPRouter 路由树及索引
 type HTTPRouter struct {
 	routerTree   *RouteTree[*Route]
 	servicePools map[string]*ServicePool
-	routeIndex   map[string]map[string]struct{} // serviceName -> set(path)
-	pathIndex    map[string]struct{}            // global path set for fast existence check
+	routeIndex   map[string]map[string]*Route // serviceName -> (pathKey -> route)
+	pathIndex    map[string]string            // pathKey -> serviceName 全局路由归属 用于快速判重
+	descriptors  *transcoder.DescriptorRegistry
+	config       Config
+	corsConfig   CORSConfig
+	cors         *corsPolicy    // 全局跨域策略
+	auth         *auth.Verifier // JWT 校验器 为 nil 时不认证
+	limiter      *rateLimiter   // 全局限流 为 nil 时不限流
+	clientIP     clientIPResolver
+	accessLog    *accesslog.Logger // 访问日志 为 nil 时不记录
 	mu           sync.RWMutex
 }
 
-func NewHTTPRouter() *HTTPRouter {
+// NewHTTPRouter 创建路由器 verifier 为 nil 时不校验 JWT accessLog 为 nil 时不记录访问日志
+func NewHTTPRouter(config Config, cors CORSConfig, verifier *auth.Verifier, rateLimit GlobalRateLimitConfig, accessLog *accesslog.Logger) *HTTPRouter {
 	return &HTTPRouter{
-		routerTree:        NewRouteTree[*Route](),
-		servicePools:      make(map[string]*ServicePool),
-		routeIndex:        make(map[string]map[string]struct{}),
-		pathIndex:         make(map[string]struct{}),
+		config:       config,
+		corsConfig:   cors,
+		cors:         newCORSPolicy("gateway", cors),
+		auth:         verifier,
+		limiter:      newRateLimiter("gateway", rateLimit.RateLimitConfig),
+		clientIP:     newClientIPResolver(rateLimit.TrustedProxies),
+		accessLog:    accessLog,
+		routerTree:   NewRouteTree[*Route](),
+		servicePools: make(map[string]*ServicePool),
+		routeIndex:   make(map[string]map[string]*Route),
+		pathIndex:    make(map[string]string),
+		descriptors:  transcoder.NewDescriptorRegistry(),
 	}
 }
 
 // RegisterService 注册服务与其路由。
-// 首次注册该 serviceName 时,根据描述符解析并注册路由,后续仅更新实例池
+// 描述符发生变化时(含首次注册)重新解析路由并与现有路由做差异同步,并切换已有 invoker 的共享描述符集;
+// 描述符未变化时仅更新实例池
 func (r *HTTPRouter) RegisterService(service *discovery.ServiceInfo) error {
 	if service == nil || strings.TrimSpace(service.ServiceName) == "" {
 		return fmt.Errorf("invalid service info")
@@ -53,63 +77,89 @@ func (r *HTTPRouter) RegisterService(service *discovery.ServiceInfo) error {
 	r.mu.Lock()
 	pool, exists := r.servicePools[serviceName]
 	if !exists {
-		pool = &ServicePool{
-			serviceName: serviceName,
-			invokers:    make(map[string]*transcoder.GRPCInvoker),
-			instances:   nil,
-		}
+		pool = newServicePool(serviceName)
 		r.servicePools[serviceName] = pool
 	}
-	// 判断是否需要注册路由
-	needRouteRegistration := len(r.routeIndex[serviceName]) == 0
 	r.mu.Unlock()
 
+	// 服务配置 传输安全配置变化时加载证书 失败时保持现状
+	var metadata map[string]string
+	if service.ServiceMetadata != nil {
+		metadata = service.Metadata
+	}
+	conf := r.config.serviceConfig(serviceName, metadata)
+	cors := r.corsConfig
+	cors.merge(corsConfigFromMetadata(serviceName, metadata))
+	pool.cors.Store(newCORSPolicy("service "+serviceName, cors))
+	creds, credsChanged, err := pool.transportCredentials(conf.TLS)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS config for %s: %w", serviceName, err)
+	}
+
+	// 判断描述符是否变化 变化时从共享注册表获取新版本(同一版本只解析一次)
+	pool.mu.RLock()
+	current := pool.descriptors
+	pool.mu.RUnlock()
+	key, hasDescriptor := descriptorKey(service.ServiceMetadata)
+	descriptorChanged := hasDescriptor && (current == nil || current.Key() != key)
+	set := current
+	if descriptorChanged {
+		acquired, err := r.descriptors.Acquire(key, service.Descriptor)
+		if err != nil {
+			return fmt.Errorf("failed to parse descriptors for %s: %w", serviceName, err)
+		}
+		set = acquired
+	}
+
 	// 对实例差异进行增删
 	// 找出需要新建 invoker 的实例地址
 	addrSet := make(map[string]struct{}, len(service.Instances))
 	toCreate := make([]*discovery.ServiceInstance, 0)
 
-	pool.mu.RLock()
-	existingInvokers := make(map[string]*transcoder.GRPCInvoker, len(pool.invokers))
-	maps.Copy(existingInvokers, pool.invokers)
-	pool.mu.RUnlock()
+	existingInvokers := pool.invokers()
 
 	for _, inst := range service.Instances {
+		if _, dup := addrSet[inst.Addr]; dup {
+			continue
+		}
 		addrSet[inst.Addr] = struct{}{}
-		if _, ok := existingInvokers[inst.Addr]; !ok {
+		// 传输凭证变化时重建全部实例的 invoker
+		if _, ok := existingInvokers[inst.Addr]; !ok || credsChanged {
 			toCreate = append(toCreate, inst)
 		}
 	}
 
+	// 描述符变化时切换已有 invoker 的描述符集
+	if descriptorChanged {
+		for addr, inv := range existingInvokers {
+			if _, alive := addrSet[addr]; !alive {
+				continue
+			}
+			inv.UpdateDescriptors(set)
+		}
+	}
+
 	// 创建缺失的 invoker
 	created := make(map[string]*transcoder.GRPCInvoker)
-	var firstFileDescs []*desc.FileDescriptor
+	if set == nil && len(toCreate) > 0 {
+		log.Printf("Warning: no descriptors for service %s, skipped %d instances", serviceName, len(toCreate))
+		toCreate = nil
+	}
 	for _, inst := range toCreate {
-		invoker, fileDescs, err := transcoder.NewGRPCInvoker(inst.Addr, service.Descriptor)
+		invoker, err := transcoder.NewGRPCInvoker(inst.Addr, set, creds)
 		if err != nil {
 			log.Printf("Warning: failed to create invoker for %s: %v", inst.Addr, err)
 			continue
 		}
 		created[inst.Addr] = invoker
-		// 捕获一次描述符用于首次注册路由
-		if needRouteRegistration && firstFileDescs == nil && len(fileDescs) > 0 {
-			firstFileDescs = fileDescs
-		}
 	}
 
-	// 合并新建 invoker 移除已下线实例
-	toClose := make([]*transcoder.GRPCInvoker, 0)
+	// 合并新建 invoker 移除已下线实例 并应用服务配置
+	toClose := pool.update(service.Instances, created, conf)
 	pool.mu.Lock()
-	// 更新实例列表
-	pool.instances = service.Instances
-	// 添加新建 invoker
-	maps.Copy(pool.invokers, created)
-	// 清理下线实例对应的 invoker
-	for addr, inv := range pool.invokers {
-		if _, alive := addrSet[addr]; !alive {
-			toClose = append(toClose, inv)
-			delete(pool.invokers, addr)
-		}
+	pool.descriptors = set
+	if credsChanged {
+		pool.tls, pool.creds = conf.TLS, creds
 	}
 	pool.mu.Unlock()
 	// 在锁外关闭连接 避免阻塞
@@ -119,62 +169,116 @@ func (r *HTTPRouter) RegisterService(service *discovery.ServiceInfo) error {
 		}
 	}
 
-	// 首次注册该服务的路
-	if needRouteRegistration {
-		if len(firstFileDescs) == 0 {
-			log.Printf("Info: skip route registration for %s due to no descriptors available yet", serviceName)
-			return nil
+	// 描述符变化时同步路由 并释放服务池对旧版本的引用
+	if descriptorChanged {
+		r.syncRoutes(serviceName, buildRoutes(serviceName, set.Files()))
+		pool.cache.clear()
+		if current != nil {
+			current.Release()
 		}
+	}
 
-		// 遍历描述符，抽取 HTTP 规则并注册路由
-		for _, fileDesc := range firstFileDescs {
-			services := fileDesc.GetServices()
-			for _, svc := range services {
-				methods := svc.GetMethods()
-				for _, method := range methods {
-					httpRules, err := transcoder.ExtractHTTPRules(method)
-					if err != nil {
-						log.Printf("Warning: failed to extract HTTP rules for %s: %v", method.GetFullyQualifiedName(), err)
+	return nil
+}
+
+// buildRoutes 遍历描述符，抽取 HTTP 规则生成 pathKey -> route
+func buildRoutes(serviceName string, fileDescs []*desc.FileDescriptor) map[string]*Route {
+	routes := make(map[string]*Route)
+	for _, fileDesc := range fileDescs {
+		for _, svc := range fileDesc.GetServices() {
+			for _, method := range svc.GetMethods() {
+				httpRules, err := transcoder.ExtractHTTPRules(method)
+				if err != nil {
+					log.Printf("Warning: failed to extract HTTP rules for %s: %v", method.GetFullyQualifiedName(), err)
+					continue
+				}
+				for _, httpRule := range httpRules {
+					pathKey := routeKey(httpRule)
+					if prev, dup := routes[pathKey]; dup {
+						log.Printf("Warning: duplicate route %s %s for %s, already bound to %s", httpRule.Method, httpRule.Path, method.GetFullyQualifiedName(), prev.FullMethod)
 						continue
 					}
-					for _, httpRule := range httpRules {
-						pathKey := normalizePath(httpRule.Method, httpRule.Path)
-						// 将检查-插入-索引更新放在同一把锁内 避免竞态
-						r.mu.Lock()
-						if _, exists := r.pathIndex[pathKey]; exists {
-							r.mu.Unlock()
-							continue
-						}
-						// 插入路由 仅在成功时更新索引
-						if err := r.routerTree.Insert(
-							pathKey,
-							&Route{
-								ServiceName: serviceName,
-								MethodName:  method.GetName(),
-								FullMethod:  fmt.Sprintf("%s/%s", svc.GetFullyQualifiedName(), method.GetName()),
-								MethodDesc:  method,
-								HttpRule:    httpRule,
-							},
-						); err != nil {
-							log.Printf("Warning: failed to insert route for %s %s: %v", serviceName, pathKey, err)
-							r.mu.Unlock()
-							continue
-						}
-						log.Printf("Registered route: %s %s -> %s", httpRule.Method, httpRule.Path, fmt.Sprintf("%s/%s", svc.GetFullyQualifiedName(), method.GetName()))
-						// 记录索引
-						if r.routeIndex[serviceName] == nil {
-							r.routeIndex[serviceName] = make(map[string]struct{})
-						}
-						r.routeIndex[serviceName][pathKey] = struct{}{}
-						r.pathIndex[pathKey] = struct{}{}
-						r.mu.Unlock()
+					routes[pathKey] = &Route{
+						ServiceName: serviceName,
+						MethodName:  method.GetName(),
+						FullMethod:  fmt.Sprintf("%s/%s", svc.GetFullyQualifiedName(), method.GetName()),
+						MethodDesc:  method,
+						HttpRule:    httpRule,
+						Policy:      httpRule.Policy,
 					}
 				}
 			}
 		}
 	}
+	return routes
+}
 
-	return nil
+// syncRoutes 将服务的路由同步为 newRoutes：删除已移除的路由、插入新增路由、原子替换已存在的路由
+func (r *HTTPRouter) syncRoutes(serviceName string, newRoutes map[string]*Route) {
+	// 将检查-插入-索引更新放在同一把锁内 避免竞态
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldRoutes := r.routeIndex[serviceName]
+	current := make(map[string]*Route, len(newRoutes))
+	var added, updated, removed int
+
+	// 删除新描述符中已不存在的路由
+	for pathKey, old := range oldRoutes {
+		if _, keep := newRoutes[pathKey]; keep {
+			continue
+		}
+		r.routerTree.Delete(pathKey)
+		delete(r.pathIndex, pathKey)
+		removed++
+		log.Printf("Removed route: %s %s -> %s", old.HttpRule.Method, old.HttpRule.Path, old.FullMethod)
+	}
+
+	for pathKey, route := range newRoutes {
+		if owner, exists := r.pathIndex[pathKey]; exists && owner != serviceName {
+			log.Printf("Warning: route %s %s already registered by service %s, skipped", route.HttpRule.Method, route.HttpRule.Path, owner)
+			continue
+		}
+		// 插入路由 已存在时原地替换值 仅在成功时更新索引
+		// 失败时旧路由仍在路由树中 保留其索引以便后续同步或注销时删除
+		if err := r.routerTree.Insert(pathKey, route); err != nil {
+			log.Printf("Warning: failed to insert route for %s %s: %v", serviceName, pathKey, err)
+			if old, existed := oldRoutes[pathKey]; existed {
+				current[pathKey] = old
+			}
+			continue
+		}
+		current[pathKey] = route
+		r.pathIndex[pathKey] = serviceName
+
+		old, existed := oldRoutes[pathKey]
+		switch {
+		case !existed:
+			added++
+			log.Printf("Registered route: %s %s -> %s", route.HttpRule.Method, route.HttpRule.Path, route.FullMethod)
+		case old.FullMethod != route.FullMethod || old.HttpRule.Path != route.HttpRule.Path || old.HttpRule.Body != route.HttpRule.Body:
+			updated++
+			log.Printf("Updated route: %s %s -> %s", route.HttpRule.Method, route.HttpRule.Path, route.FullMethod)
+		}
+	}
+
+	r.routeIndex[serviceName] = current
+	if added > 0 || updated > 0 || removed > 0 {
+		log.Printf("Synced routes for %s: %d added, %d updated, %d removed", serviceName, added, updated, removed)
+	}
+}
+
+// descriptorKey 计算服务描述符集标识 描述符为空时返回 false
+func descriptorKey(metadata *discovery.ServiceMetadata) (transcoder.DescriptorKey, bool) {
+	if metadata == nil || metadata.Descriptor == nil || len(metadata.DescriptorData) == 0 {
+		return transcoder.DescriptorKey{}, false
+	}
+	sum := sha256.Sum256(metadata.DescriptorData)
+	return transcoder.DescriptorKey{
+		Service: metadata.ServiceName,
+		Version: metadata.Version,
+		Digest:  hex.EncodeToString(sum[:]),
+	}, true
 }
 
 // UnRegisterService 注销服务
@@ -200,33 +304,56 @@ func (r *HTTPRouter) UnRegisterService(service *discovery.ServiceInfo) error {
 
 	// 关闭 invokers 并清理实例
 	if pool != nil {
-		toClose := make([]*transcoder.GRPCInvoker, 0)
-		pool.mu.Lock()
-		for addr, inv := range pool.invokers {
-			toClose = append(toClose, inv)
-			delete(pool.invokers, addr)
-		}
-		pool.instances = nil
-		pool.mu.Unlock()
+		toClose, set := pool.clear()
 		for _, inv := range toClose {
 			if err := inv.Close(); err != nil {
 				log.Printf("Debug: failed to close invoker %v: %v", inv, err)
 			}
 		}
+		if set != nil {
+			set.Release()
+		}
 	}
 	log.Printf("Remove service: %s", serviceName)
 	return nil
 }
 
+// Instances 获取所有服务的实例状态(健康状态、权重、进行中请求数、延迟) serviceName -> 实例列表
+func (r *HTTPRouter) Instances() map[string][]InstanceStatus {
+	r.mu.RLock()
+	pools := make(map[string]*ServicePool, len(r.servicePools))
+	maps.Copy(pools, r.servicePools)
+	r.mu.RUnlock()
+
+	out := make(map[string][]InstanceStatus, len(pools))
+	for name, pool := range pools {
+		out[name] = pool.status()
+	}
+	return out
+}
+
+// RouteCounts 获取每个服务已注册的路由数 serviceName -> 路由数
+func (r *HTTPRouter) RouteCounts() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]int, len(r.routeIndex))
+	for name, routes := range r.routeIndex {
+		out[name] = len(routes)
+	}
+	return out
+}
+
 func (r *HTTPRouter) Close() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	for _, pool := range r.servicePools {
-		pool.mu.Lock()
-		for _, invoker := range pool.invokers {
+		toClose, set := pool.clear()
+		for _, invoker := range toClose {
 			invoker.Close()
 		}
-		pool.mu.Unlock()
+		if set != nil {
+			set.Release()
+		}
 	}
 }
@@ -1,19 +1,25 @@
 package router
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
+	"pilot/internal/auth"
 	"pilot/internal/transcoder"
 
 	"github.com/bytedance/sonic"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type Result struct {
@@ -23,10 +29,51 @@ type Result struct {
 }
 
 func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// 路由匹配
-	pathKey := normalizePath(strings.ToUpper(req.Method), req.URL.Path)
-	matchedRoute, pathParams, ok := r.routerTree.Lookup(pathKey)
-	if !ok || matchedRoute == nil {
+	start := time.Now()
+	req, span := startServerSpan(req)
+	id := requestID(w, req)
+	rec := &responseRecorder{ResponseWriter: w}
+	var body *countingBody
+	if r.accessLog != nil && req.Body != nil {
+		body = &countingBody{ReadCloser: req.Body}
+		req.Body = body
+	}
+	r.serve(rec, req)
+	elapsed := time.Since(start)
+	rec.observe(elapsed)
+	rec.endSpan(span)
+	if r.accessLog != nil {
+		r.logAccess(rec, req, span, id, start, elapsed, body)
+	}
+}
+
+// serve 处理请求 匹配的路由与上游调用结果记录在 w 中
+func (r *HTTPRouter) serve(w *responseRecorder, req *http.Request) {
+	// 声明请求头仅由认证写入 无论是否开启认证都清除调用方伪造的值
+	auth.StripClaimHeaders(req.Header)
+
+	// CORS 预检 按路径上实际注册的方法响应
+	if isPreflight(req) {
+		r.servePreflight(w, req)
+		return
+	}
+
+	// 路由匹配 WebSocket 握手优先匹配客户端流式/双向流式方法
+	var (
+		matchedRoute *Route
+		pathParams   map[string]string
+		ok           bool
+		err          error
+	)
+	upgrade := isWebSocketUpgrade(req)
+	if upgrade {
+		matchedRoute, pathParams, ok, err = r.matchWebSocket(req.URL.EscapedPath())
+	}
+	if !ok {
+		matchedRoute, pathParams, ok, err = r.match(strings.ToUpper(req.Method), req.URL.EscapedPath())
+	}
+	if !ok {
+		r.cors.apply(w, req)
 		writeJSON(w, http.StatusNotFound, Result{
 			Code: http.StatusNotFound,
 			Msg:  fmt.Sprintf("No route found for %s %s", req.Method, req.URL.Path),
@@ -34,9 +81,21 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		})
 		return
 	}
+	w.route = matchedRoute
+	r.corsPolicy(matchedRoute.ServiceName).apply(w, req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{
+			Code: http.StatusBadRequest,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+		return
+	}
 
 	// 选择服务实例
+	r.mu.RLock()
 	pool, ok := r.servicePools[matchedRoute.ServiceName]
+	r.mu.RUnlock()
 	if !ok {
 		writeJSON(w, http.StatusServiceUnavailable, Result{
 			Code: http.StatusServiceUnavailable,
@@ -45,7 +104,31 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		})
 		return
 	}
-	invoker, err := pool.getNextInvoker()
+
+	// JWT 认证 在选择实例与调用上游前拒绝未认证的请求
+	policy := pool.routePolicy(matchedRoute)
+	// 缓存键按认证前的请求头计算 认证可能移除 Authorization
+	cacheKey, cacheable := policy.cache.key(matchedRoute, req, r.limiter.credentialHeader(), policy.rateLimit.credentialHeader())
+	var claims map[string]any
+	if r.auth != nil {
+		if claims, ok = r.authenticate(w, req, policy.authRequired); !ok {
+			return
+		}
+	}
+	// 限流 认证之后进行 以便按 JWT 声明限流
+	if !r.admit(w, req, matchedRoute, policy.rateLimit, claims) {
+		return
+	}
+	if policy.maxBodyBytes > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, policy.maxBodyBytes)
+	}
+
+	// 响应缓存 命中时不调用上游
+	if cacheable && !upgrade && pool.cache.serveCached(w, req, cacheKey) {
+		return
+	}
+
+	upstream, err := pool.pick(req, pathParams)
 	if err != nil {
 		writeJSON(w, http.StatusServiceUnavailable, Result{
 			Code: http.StatusServiceUnavailable,
@@ -54,9 +137,43 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		})
 		return
 	}
+	invoker := upstream.invoker
+	// 熔断器 流式调用仅在熔断打开时被拒绝 不参与统计
+	breaker := pool.breaker(matchedRoute.FullMethod)
 
-	// 构建请求参数
-	requestJSON, err := buildRequestPayload(req, pathParams, matchedRoute.HttpRule.Body)
+	// 客户端流式/双向流式方法 通过 WebSocket 桥接
+	if matchedRoute.MethodDesc.IsClientStreaming() {
+		if !upgrade {
+			writeJSON(w, http.StatusBadRequest, Result{
+				Code: http.StatusBadRequest,
+				Msg:  fmt.Sprintf("Method %s is client-streaming and requires a WebSocket connection", matchedRoute.FullMethod),
+				Data: nil,
+			})
+			return
+		}
+		if _, ok := allowCircuit(w, breaker, false); !ok {
+			return
+		}
+		upstream.acquire()
+		defer upstream.release()
+		ctxWithMD := metadata.NewOutgoingContext(req.Context(), buildOutgoingMD(req))
+		r.serveWebSocket(ctxWithMD, w, req, matchedRoute, pool, upstream)
+		return
+	}
+
+	// 由 HTTP 请求直接构建请求消息
+	method := matchedRoute.MethodDesc.UnwrapMethod()
+	resolver := invoker.Resolver()
+	reqMsg, err := buildRequestMessage(req, matchedRoute, pathParams, resolver)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, Result{
+			Code: http.StatusRequestEntityTooLarge,
+			Msg:  fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit),
+			Data: nil,
+		})
+		return
+	}
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, Result{
 			Code: http.StatusBadRequest,
@@ -66,33 +183,84 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	w.reqMsg, w.resolver = reqMsg, resolver
+
 	// 附带 HTTP Header -> gRPC Metadata
 	ctxWithMD := metadata.NewOutgoingContext(req.Context(), buildOutgoingMD(req))
 
-	// gRPC 调用
-	responseJSON, err := invoker.InvokeMethod(
-		ctxWithMD,
-		matchedRoute.FullMethod,
-		requestJSON,
-	)
+	// 服务端流式方法 逐条推送响应(SSE / NDJSON)
+	if matchedRoute.MethodDesc.IsServerStreaming() {
+		if _, ok := allowCircuit(w, breaker, false); !ok {
+			return
+		}
+		upstream.acquire()
+		defer upstream.release()
+		r.serveServerStream(ctxWithMD, w, req, matchedRoute, pool, upstream, reqMsg)
+		return
+	}
+
+	// 调用超时 调用方指定的超时受路由策略上限约束
+	timeout, err := policy.timeout.resolve(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{
+			Code: http.StatusBadRequest,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+		return
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctxWithMD, cancel = context.WithTimeout(ctxWithMD, timeout)
+		defer cancel()
+	}
+
+	// gRPC 调用 按路由策略跨实例重试/对冲 仅一元调用计入实例延迟 流式调用耗时取决于流的生命周期
+	generation, ok := allowCircuit(w, breaker, true)
+	if !ok {
+		return
+	}
+	start := time.Now()
+	resp, served, attempts, err := pool.invokeUnary(ctxWithMD, req, pathParams, method, reqMsg, policy.retry, upstream)
+	if breaker != nil {
+		breaker.record(generation, err, time.Since(start))
+	}
+	w.Header().Set(attemptsHeader, strconv.Itoa(attempts))
+	w.upstreamResult(served, err)
+	w.respMsg = resp
+	if err != nil && status.Code(err) == codes.DeadlineExceeded {
+		writeJSON(w, http.StatusGatewayTimeout, Result{
+			Code: int(codes.DeadlineExceeded),
+			Msg:  deadlineMessage(matchedRoute.FullMethod, timeout, err),
+			Data: nil,
+		})
+		return
+	}
 	if err != nil {
 		statusCode, res := mapErrorToHTTP(err)
 		writeJSON(w, statusCode, res)
 		return
 	}
 
-	data := decodeResponseJSON(responseJSON)
-	writeJSON(w, http.StatusOK, Result{
-		Code: int(codes.OK),
-		Msg:  "success",
-		Data: data,
-	})
+	if cacheable {
+		body, err := appendMessage(nil, resp, matchedRoute.HttpRule.ResponseBody, resolver)
+		if err == nil {
+			pool.cache.put(cacheKey, body, policy.cache.ttl, time.Now())
+			w.Header().Set(cacheHeader, "MISS")
+			writeBody(w, body)
+			return
+		}
+	}
+	writeMessage(w, resp, matchedRoute.HttpRule.ResponseBody, resolver)
 }
 
 // NormalizePath 统一规范路由注册路径
-// 生成的格式固定为：/[METHOD]/cleanedPath
-func normalizePath(method string, p string) string {
+// 生成的格式固定为：/[METHOD]/cleanedPath 带自定义动词时为 /[METHOD:verb]/cleanedPath
+func normalizePath(method string, verb string, p string) string {
 	m := strings.ToUpper(strings.TrimSpace(method))
+	if verb != "" {
+		m += ":" + verb
+	}
 	clean := strings.TrimSpace(p)
 	// 去除前导斜杠，统一用 path.Clean 再补齐
 	clean = strings.TrimPrefix(clean, "/")
@@ -112,7 +280,7 @@ func mapGRPCCodeToHTTP(code codes.Code) int {
 	case codes.InvalidArgument:
 		return http.StatusBadRequest
 	case codes.DeadlineExceeded:
-		return http.StatusRequestTimeout
+		return http.StatusGatewayTimeout
 	case codes.NotFound:
 		return http.StatusNotFound
 	case codes.AlreadyExists:
@@ -151,9 +319,83 @@ func writeJSON(w http.ResponseWriter, status int, res Result) {
 	}
 }
 
-// buildRequestPayload 构建转码后的请求负载
-func buildRequestPayload(req *http.Request, pathParams map[string]string, bodyField string) ([]byte, error) {
-	return transcoder.BuildRequestJSON(req, pathParams, bodyField)
+// writeMessage 以统一响应格式输出响应消息 消息以 protojson 直接写入 data 字段
+func writeMessage(w http.ResponseWriter, msg proto.Message, responseBody string, resolver transcoder.TypeResolver) {
+	buf := transcoder.GetBuffer()
+	defer transcoder.PutBuffer(buf)
+
+	b, err := appendMessage((*buf)[:0], msg, responseBody, resolver)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Result{
+			Code: -1,
+			Msg:  fmt.Sprintf("Failed to encode response: %v", err),
+			Data: nil,
+		})
+		return
+	}
+	*buf = b
+	writeBody(w, b)
+}
+
+// appendMessage 将统一格式的成功响应追加到 b
+func appendMessage(b []byte, msg proto.Message, responseBody string, resolver transcoder.TypeResolver) ([]byte, error) {
+	b = append(b, `{"code":0,"msg":"success","data":`...)
+	b, err := transcoder.AppendResponse(b, msg, responseBody, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, "}\n"...), nil
+}
+
+// writeBody 输出已编码的成功响应
+func writeBody(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(b); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// allowCircuit 熔断检查 熔断打开时输出 503 与 Retry-After
+func allowCircuit(w http.ResponseWriter, breaker *circuitBreaker, trial bool) (uint64, bool) {
+	if breaker == nil {
+		return 0, true
+	}
+	generation, retryAfter, ok := breaker.allow(trial)
+	if ok {
+		return generation, true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeJSON(w, http.StatusServiceUnavailable, Result{
+		Code: http.StatusServiceUnavailable,
+		Msg:  fmt.Sprintf("Circuit breaker for %s is open", breaker.name),
+		Data: nil,
+	})
+	return 0, false
+}
+
+// authenticate 校验请求携带的 JWT 返回已验证的声明 失败时输出 401 与 WWW-Authenticate
+func (r *HTTPRouter) authenticate(w http.ResponseWriter, req *http.Request, required bool) (map[string]any, bool) {
+	claims, err := r.auth.Authenticate(req, required)
+	if err == nil {
+		return claims, true
+	}
+	if errors.Is(err, auth.ErrMissingToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pilot"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="pilot", error="invalid_token"`)
+	}
+	writeJSON(w, http.StatusUnauthorized, Result{
+		Code: http.StatusUnauthorized,
+		Msg:  fmt.Sprintf("Unauthorized: %v", err),
+		Data: nil,
+	})
+	return nil, false
+}
+
+// buildRequestMessage 构建转码后的请求消息
+func buildRequestMessage(req *http.Request, route *Route, pathParams map[string]string, resolver transcoder.TypeResolver) (proto.Message, error) {
+	return transcoder.DecodeRequest(req, route.MethodDesc.GetInputType().UnwrapMessage(), pathParams, route.HttpRule.Body, resolver)
 }
 
 // buildOutgoingMD 将 HTTP Header 写入 gRPC Metadata
@@ -165,7 +407,9 @@ func buildOutgoingMD(req *http.Request) metadata.MD {
 		"transfer-encoding": {}, "upgrade": {}, "upgrade-insecure-requests": {},
 		"content-length": {}, "content-type": {}, "user-agent": {},
 		"accept": {}, "accept-encoding": {}, "accept-language": {}, "origin": {}, "referer": {},
-		"te": {},
+		"te": {}, "sec-websocket-key": {}, "sec-websocket-version": {},
+		"sec-websocket-extensions": {}, "sec-websocket-protocol": {},
+		"grpc-timeout": {}, "x-request-timeout": {},
 	}
 	for k, vals := range req.Header {
 		lk := strings.ToLower(k)
@@ -179,6 +423,15 @@ func buildOutgoingMD(req *http.Request) metadata.MD {
 	return md
 }
 
+// deadlineMessage 上游调用超时的错误说明
+func deadlineMessage(fullMethod string, timeout time.Duration, err error) string {
+	msg := status.Convert(err).Message()
+	if timeout > 0 {
+		return fmt.Sprintf("Upstream %s did not respond within %s: %s", fullMethod, timeout, msg)
+	}
+	return fmt.Sprintf("Upstream %s deadline exceeded: %s", fullMethod, msg)
+}
+
 // mapErrorToHTTP 将 gRPC/内部错误映射为 HTTP 响应
 func mapErrorToHTTP(err error) (int, Result) {
 	if st, ok := status.FromError(err); ok {
@@ -187,12 +440,3 @@ func mapErrorToHTTP(err error) (int, Result) {
 	}
 	return http.StatusInternalServerError, Result{Code: -1, Msg: err.Error(), Data: nil}
 }
-
-// decodeResponseJSON 尝试解码响应体为结构化数据
-func decodeResponseJSON(b []byte) any {
-	var data any
-	if err := json.Unmarshal(b, &data); err != nil {
-		return json.RawMessage(b)
-	}
-	return data
-}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeStripsClaimHeadersWithoutAuth(t *testing.T) {
+	r := newTemplateRouter(t, [][2]string{{"GET", "/v1/users/{id}"}})
+	req := httptest.NewRequest("GET", "/v1/users/1", nil)
+	req.Header.Set("X-Jwt-Claim-Sub", "admin")
+	req.Header.Add("X-Jwt-Claim-Scope", "write")
+	req.Header.Set("X-Request-Id", "r1")
+
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	md := buildOutgoingMD(req)
+	for _, k := range []string{"x-jwt-claim-sub", "x-jwt-claim-scope"} {
+		if v := md.Get(k); len(v) != 0 {
+			t.Errorf("metadata %s = %v, want spoofed claim dropped", k, v)
+		}
+	}
+	if v := md.Get("x-request-id"); len(v) != 1 || v[0] != "r1" {
+		t.Errorf("metadata x-request-id = %v, want [r1]", v)
+	}
+}
@@ -2,39 +2,353 @@ package router
 
 import (
 	"fmt"
+	"net/http"
 	"pilot/internal/discovery"
+	"pilot/internal/metrics"
 	"pilot/internal/transcoder"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/credentials"
 )
 
 // ServicePool 服务池 用于负载均衡调用
 // 维护一个服务名下的所有实例与其 invoker。
 type ServicePool struct {
 	serviceName string
-	invokers    map[string]*transcoder.GRPCInvoker // key: ip地址
-	instances   []*discovery.ServiceInstance
-	counter     int64
+	upstreams   map[string]*Upstream      // key: ip地址
+	ordered     []*Upstream               // 按实例注册顺序排列
+	available   []*Upstream               // 可被选择的实例(已排除不健康实例)
+	descriptors *transcoder.DescriptorSet // 当前版本的共享描述符集 持有一次引用
+	config      ServiceConfig
+	balancer    Balancer
+	hashKey     func(req *http.Request, pathParams map[string]string) string
+	outlier     atomic.Pointer[OutlierConfig] // 供请求路径无锁读取
+	stopOutlier chan struct{}
+	breakerConf BreakerConfig
+	breakers    map[string]*circuitBreaker // key: 方法全名 按服务熔断时为空串
+	breakerMu   sync.Mutex
+	budget      *retryBudget
+	policies    map[*Route]routePolicy  // 路由策略缓存 配置更新时清空
+	limiters    map[string]routeLimiter // key: 方法全名 限流配置未变化时跨配置更新保留令牌桶
+	policyMu    sync.Mutex
+	tls         TLSConfig                        // 当前 invoker 使用的传输安全配置
+	creds       credentials.TransportCredentials // nil 表示明文连接
+	cors        atomic.Pointer[corsPolicy]       // 合并服务 metadata 后的跨域策略
+	cache       responseCache                    // GET 一元调用的响应缓存
 	mu          sync.RWMutex
 }
 
-// getNextInvoker 获取下一个可用的 invoker
-func (pool *ServicePool) getNextInvoker() (*transcoder.GRPCInvoker, error) {
+func newServicePool(serviceName string) *ServicePool {
+	return &ServicePool{
+		serviceName: serviceName,
+		upstreams:   make(map[string]*Upstream),
+		balancer:    newBalancer(serviceName, PolicyRoundRobin),
+	}
+}
+
+// pick 按负载均衡策略选择一个实例 优先排除 exclude 中的实例(如已尝试过的实例)
+func (pool *ServicePool) pick(req *http.Request, pathParams map[string]string, exclude ...*Upstream) (*Upstream, error) {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
 
-	if len(pool.instances) == 0 {
+	if len(pool.ordered) == 0 {
 		return nil, fmt.Errorf("no available instances")
 	}
+	if len(pool.available) == 0 {
+		return nil, fmt.Errorf("no healthy instances for service %s", pool.serviceName)
+	}
 
-	start := atomic.AddInt64(&pool.counter, 1)
-	n := len(pool.instances)
-	for i := range n {
-		idx := int((start + int64(i)) % int64(n))
-		instance := pool.instances[idx]
-		if invoker, ok := pool.invokers[instance.Addr]; ok && invoker != nil {
-			return invoker, nil
+	candidates := pool.available
+	if len(exclude) > 0 {
+		candidates = make([]*Upstream, 0, len(pool.available))
+		for _, u := range pool.available {
+			if !slices.Contains(exclude, u) {
+				candidates = append(candidates, u)
+			}
+		}
+		// 没有其他实例时仍允许选择已尝试过的实例
+		if len(candidates) == 0 {
+			candidates = pool.available
 		}
 	}
+
+	var key string
+	if pool.hashKey != nil {
+		key = pool.hashKey(req, pathParams)
+	}
+	if u := pool.balancer.Pick(candidates, key); u != nil {
+		return u, nil
+	}
 	return nil, fmt.Errorf("no invoker available for service %s", pool.serviceName)
 }
+
+// invokers 当前所有 invoker
+func (pool *ServicePool) invokers() map[string]*transcoder.GRPCInvoker {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	invokers := make(map[string]*transcoder.GRPCInvoker, len(pool.upstreams))
+	for addr, u := range pool.upstreams {
+		invokers[addr] = u.invoker
+	}
+	return invokers
+}
+
+// update 应用新的实例集合与服务配置 返回需关闭的下线实例 invoker
+// created 为新建的 invoker 未出现在 created 且不在 pool 中的实例将被忽略
+func (pool *ServicePool) update(instances []*discovery.ServiceInstance, created map[string]*transcoder.GRPCInvoker, conf ServiceConfig) []*transcoder.GRPCInvoker {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// 策略或哈希键变化时重建负载均衡器
+	if conf.Balancer.Policy != pool.config.Balancer.Policy {
+		pool.balancer = newBalancer(pool.serviceName, conf.Balancer.Policy)
+	}
+	if conf.Balancer.HashOn != pool.config.Balancer.HashOn || pool.hashKey == nil {
+		pool.hashKey = hashKeyFunc(pool.serviceName, conf.Balancer.HashOn)
+	}
+	// 健康检查配置变化时重启所有实例的探测
+	if conf.HealthCheck != pool.config.HealthCheck {
+		for _, u := range pool.upstreams {
+			u.stopHealthCheck()
+			pool.startHealthCheck(u, conf.HealthCheck)
+		}
+	}
+	// 异常检测配置变化时重启周期分析
+	if !conf.Outlier.equal(pool.config.Outlier) || pool.outlier.Load() == nil {
+		pool.stopOutlierDetection()
+		pool.startOutlierDetection(conf.Outlier)
+		outlier := conf.Outlier
+		pool.outlier.Store(&outlier)
+	}
+	// 熔断配置变化时重置所有熔断器
+	if !conf.Breaker.equal(pool.config.Breaker) {
+		pool.breakerMu.Lock()
+		pool.breakerConf = conf.Breaker
+		pool.breakers = nil
+		pool.breakerMu.Unlock()
+	}
+	// 重试预算配置变化时重置预算 路由策略缓存随配置更新清空
+	if conf.Retry.BudgetPercent != pool.config.Retry.BudgetPercent || conf.Retry.BudgetMinPerSecond != pool.config.Retry.BudgetMinPerSecond || pool.budget == nil {
+		pool.budget = newRetryBudget(conf.Retry.BudgetPercent, conf.Retry.BudgetMinPerSecond)
+	}
+	pool.policyMu.Lock()
+	pool.policies = nil
+	pool.policyMu.Unlock()
+	pool.config = conf
+
+	toClose := make([]*transcoder.GRPCInvoker, 0)
+	for addr, inv := range created {
+		// 替换已有实例(如传输安全配置变化后重建的 invoker)
+		if old, ok := pool.upstreams[addr]; ok {
+			old.stopHealthCheck()
+			toClose = append(toClose, old.invoker)
+		}
+		u := newUpstream(addr, inv)
+		pool.upstreams[addr] = u
+		pool.startHealthCheck(u, conf.HealthCheck)
+	}
+
+	// 按实例顺序重建列表 清理下线实例
+	alive := make(map[string]struct{}, len(instances))
+	ordered := make([]*Upstream, 0, len(instances))
+	for _, inst := range instances {
+		if _, dup := alive[inst.Addr]; dup {
+			continue
+		}
+		alive[inst.Addr] = struct{}{}
+		if u, ok := pool.upstreams[inst.Addr]; ok {
+			ordered = append(ordered, u)
+		}
+	}
+	for addr, u := range pool.upstreams {
+		if _, ok := alive[addr]; !ok {
+			u.stopHealthCheck()
+			toClose = append(toClose, u.invoker)
+			delete(pool.upstreams, addr)
+			metrics.RemoveUpstream(pool.serviceName, addr)
+		}
+	}
+
+	// 应用权重
+	weights := parseWeights(pool.serviceName, conf.Balancer.Weights)
+	for _, u := range ordered {
+		u.weight = 1
+		if w, ok := weights[u.addr]; ok {
+			u.weight = w
+		}
+	}
+
+	pool.ordered = ordered
+	pool.refreshLocked()
+	return toClose
+}
+
+// transportCredentials 获取连接上游使用的传输凭证 配置变化时重新加载证书
+// 返回凭证是否变化 变化后需重建已有实例的 invoker
+func (pool *ServicePool) transportCredentials(conf TLSConfig) (credentials.TransportCredentials, bool, error) {
+	pool.mu.RLock()
+	current, creds := pool.tls, pool.creds
+	pool.mu.RUnlock()
+	if conf.equal(current) {
+		return creds, false, nil
+	}
+	if !conf.enabled() {
+		return nil, true, nil
+	}
+	cc, err := transcoder.NewClientCredentials(transcoder.TLSOptions{
+		CAFile:     conf.CAFile,
+		CertFile:   conf.CertFile,
+		KeyFile:    conf.KeyFile,
+		ServerName: conf.ServerName,
+		SPIFFEIDs:  conf.SPIFFEIDs,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return cc.TransportCredentials(), true, nil
+}
+
+// breaker 获取方法对应的熔断器 未开启熔断时返回 nil
+func (pool *ServicePool) breaker(fullMethod string) *circuitBreaker {
+	pool.breakerMu.Lock()
+	defer pool.breakerMu.Unlock()
+
+	if !pool.breakerConf.enabled() {
+		return nil
+	}
+	key, name := "", pool.serviceName
+	if pool.breakerConf.perMethod() {
+		key, name = fullMethod, fullMethod
+	}
+	b, ok := pool.breakers[key]
+	if !ok {
+		if pool.breakers == nil {
+			pool.breakers = make(map[string]*circuitBreaker)
+		}
+		b = newCircuitBreaker(name, pool.breakerConf)
+		pool.breakers[key] = b
+	}
+	return b
+}
+
+// routePolicy 单个路由的调用策略
+type routePolicy struct {
+	retry        retryPolicy
+	timeout      timeoutPolicy
+	cache        cachePolicy
+	rateLimit    *rateLimiter // 路由限流 为 nil 时不限流
+	authRequired bool         // 是否必须携带有效令牌
+	maxBodyBytes int64        // 请求体大小上限 为 0 时不单独限制
+}
+
+// routeLimiter 路由的限流器及其配置
+type routeLimiter struct {
+	conf    RateLimitConfig
+	limiter *rateLimiter
+}
+
+// routePolicy 获取路由的调用策略 首次使用时按服务配置生成并缓存
+func (pool *ServicePool) routePolicy(route *Route) routePolicy {
+	pool.policyMu.Lock()
+	defer pool.policyMu.Unlock()
+	if policy, ok := pool.policies[route]; ok {
+		return policy
+	}
+
+	pool.mu.RLock()
+	conf := pool.config.routeConfig(route)
+	pool.mu.RUnlock()
+
+	policy := routePolicy{
+		retry:        newRetryPolicy(pool.serviceName, route, conf.Retry),
+		timeout:      newTimeoutPolicy(conf.Timeout),
+		cache:        newCachePolicy(route, conf.Cache),
+		rateLimit:    pool.routeLimiterLocked(route, conf.RateLimit),
+		authRequired: conf.Auth.required(),
+		maxBodyBytes: conf.Body.MaxBytes,
+	}
+	if pool.policies == nil {
+		pool.policies = make(map[*Route]routePolicy)
+	}
+	pool.policies[route] = policy
+	return policy
+}
+
+// routeLimiterLocked 获取路由的限流器 配置变化时重建 调用方持有 pool.policyMu
+func (pool *ServicePool) routeLimiterLocked(route *Route, conf RateLimitConfig) *rateLimiter {
+	if current, ok := pool.limiters[route.FullMethod]; ok && current.conf == conf {
+		return current.limiter
+	}
+	limiter := newRateLimiter(route.FullMethod, conf)
+	if pool.limiters == nil {
+		pool.limiters = make(map[string]routeLimiter)
+	}
+	pool.limiters[route.FullMethod] = routeLimiter{conf: conf, limiter: limiter}
+	return limiter
+}
+
+// refreshLocked 按实例当前状态重建可选实例列表并同步到负载均衡器 调用方持有 pool.mu 写锁
+func (pool *ServicePool) refreshLocked() {
+	available := make([]*Upstream, 0, len(pool.ordered))
+	for _, u := range pool.ordered {
+		if u.available() {
+			available = append(available, u)
+		}
+	}
+	pool.available = available
+	pool.balancer.Update(slices.Clone(available))
+}
+
+// InstanceStatus 实例状态快照
+type InstanceStatus struct {
+	Addr        string        `json:"addr"`
+	State       string        `json:"state"` // gRPC 连接状态
+	Healthy     bool          `json:"healthy"`
+	Ejected     bool          `json:"ejected"`
+	Weight      int           `json:"weight"`
+	Outstanding int64         `json:"outstanding"`
+	Latency     time.Duration `json:"latency_ns"`
+}
+
+// status 获取服务池内所有实例的状态 按实例注册顺序排列
+func (pool *ServicePool) status() []InstanceStatus {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	out := make([]InstanceStatus, 0, len(pool.ordered))
+	for _, u := range pool.ordered {
+		out = append(out, InstanceStatus{
+			Addr:        u.addr,
+			State:       u.invoker.State().String(),
+			Healthy:     u.Healthy(),
+			Ejected:     u.Ejected(),
+			Weight:      u.weight,
+			Outstanding: u.Outstanding(),
+			Latency:     u.Latency(),
+		})
+	}
+	return out
+}
+
+// clear 移除全部实例 返回需关闭的 invoker 与服务池持有的描述符集
+func (pool *ServicePool) clear() ([]*transcoder.GRPCInvoker, *transcoder.DescriptorSet) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	toClose := make([]*transcoder.GRPCInvoker, 0, len(pool.upstreams))
+	for addr, u := range pool.upstreams {
+		u.stopHealthCheck()
+		toClose = append(toClose, u.invoker)
+		delete(pool.upstreams, addr)
+		metrics.RemoveUpstream(pool.serviceName, addr)
+	}
+	pool.stopOutlierDetection()
+	pool.ordered = nil
+	pool.available = nil
+	set := pool.descriptors
+	pool.descriptors = nil
+	pool.cache.clear()
+	return toClose, set
+}
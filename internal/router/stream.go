@@ -0,0 +1,152 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pilot/internal/transcoder"
+
+	"github.com/bytedance/sonic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	contentTypeSSE    = "text/event-stream"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// StreamStatus 流结束时发送的最终状态
+type StreamStatus struct {
+	Code     int                 `json:"code"`
+	Msg      string              `json:"msg"`
+	Trailers map[string][]string `json:"trailers,omitempty"`
+}
+
+// streamWriter 将流式响应逐条写出并立即刷新
+type streamWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	sse     bool
+	started bool
+}
+
+// newStreamWriter 根据 Accept 头选择 SSE 或 NDJSON 格式
+func newStreamWriter(w http.ResponseWriter, req *http.Request) *streamWriter {
+	return &streamWriter{
+		w:   w,
+		rc:  http.NewResponseController(w),
+		sse: strings.Contains(req.Header.Get("Accept"), contentTypeSSE),
+	}
+}
+
+// start 写出响应头 并解除 http.Server 写超时对长连接的限制
+func (sw *streamWriter) start() {
+	if sw.started {
+		return
+	}
+	sw.started = true
+	if err := sw.rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Debug: failed to clear write deadline for stream: %v", err)
+	}
+	header := sw.w.Header()
+	if sw.sse {
+		header.Set("Content-Type", contentTypeSSE)
+	} else {
+		header.Set("Content-Type", contentTypeNDJSON)
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	sw.w.WriteHeader(http.StatusOK)
+}
+
+// writeMessage 写出一条响应消息
+// SSE: event: message / data: <msg>
+// NDJSON: {"result": <msg>}
+func (sw *streamWriter) writeMessage(msg []byte) error {
+	sw.start()
+	var err error
+	if sw.sse {
+		_, err = fmt.Fprintf(sw.w, "event: message\ndata: %s\n\n", msg)
+	} else {
+		_, err = fmt.Fprintf(sw.w, "{\"result\":%s}\n", msg)
+	}
+	if err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// writeStatus 写出最终状态
+// SSE: event: status / data: <status>
+// NDJSON: {"status": <status>}
+func (sw *streamWriter) writeStatus(st StreamStatus) error {
+	sw.start()
+	b, err := sonic.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if sw.sse {
+		_, err = fmt.Fprintf(sw.w, "event: status\ndata: %s\n\n", b)
+	} else {
+		_, err = fmt.Fprintf(sw.w, "{\"status\":%s}\n", b)
+	}
+	if err != nil {
+		return err
+	}
+	return sw.rc.Flush()
+}
+
+// serveServerStream 处理服务端流式方法 每条响应到达即推送给客户端
+// 客户端断开时请求上下文取消 上游流随之取消
+func (r *HTTPRouter) serveServerStream(ctx context.Context, w *responseRecorder, req *http.Request, route *Route, pool *ServicePool, upstream *Upstream, reqMsg proto.Message) {
+	sw := newStreamWriter(w, req)
+	resolver := upstream.invoker.Resolver()
+
+	buf := transcoder.GetBuffer()
+	defer transcoder.PutBuffer(buf)
+	onMessage := func(msg proto.Message) error {
+		b, err := transcoder.AppendResponse((*buf)[:0], msg, route.HttpRule.ResponseBody, resolver)
+		if err != nil {
+			return err
+		}
+		*buf = b
+		return sw.writeMessage(b)
+	}
+	ctx, span := startClientSpan(ctx, route.FullMethod, upstream.addr)
+	trailers, err := upstream.invoker.InvokeServerStream(ctx, route.MethodDesc.UnwrapMethod(), reqMsg, onMessage)
+	pool.observeUpstream(upstream, err)
+	endClientSpan(span, err)
+	w.upstreamResult(upstream, err)
+
+	// 尚未发送任何消息时 按普通请求返回错误
+	if err != nil && !sw.started {
+		statusCode, res := mapErrorToHTTP(err)
+		writeJSON(w, statusCode, res)
+		return
+	}
+
+	// 客户端已断开 无需再写
+	if ctx.Err() != nil {
+		return
+	}
+
+	st := StreamStatus{Code: int(codes.OK), Msg: "success", Trailers: trailers}
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			st.Code = int(s.Code())
+			st.Msg = s.Message()
+		} else {
+			st.Code = int(codes.Unknown)
+			st.Msg = err.Error()
+		}
+	}
+	if werr := sw.writeStatus(st); werr != nil {
+		log.Printf("Debug: failed to write stream status for %s: %v", route.FullMethod, werr)
+	}
+}
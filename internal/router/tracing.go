@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tracer 未启用追踪时为空实现 仍会透传调用方的 trace context
+var tracer = otel.Tracer("pilot/router")
+
+// propagator W3C traceparent / tracestate 与 baggage
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// startServerSpan 从请求头提取调用方的 trace context 并开始服务端 span
+// 匹配路由前以 HTTP 方法命名 结束时改为路由模板
+func startServerSpan(req *http.Request) (*http.Request, trace.Span) {
+	ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := tracer.Start(ctx, req.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	return req.WithContext(ctx), span
+}
+
+// endSpan 以匹配的路由与响应状态结束服务端 span
+func (w *responseRecorder) endSpan(span trace.Span) {
+	if !span.IsRecording() {
+		span.End()
+		return
+	}
+	code := w.status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if w.route != nil {
+		span.SetName(routeTemplate(w.route))
+		span.SetAttributes(
+			attribute.String("http.route", w.route.HttpRule.Path),
+			attribute.String("pilot.service", w.route.ServiceName),
+			attribute.String("pilot.method", w.route.FullMethod),
+		)
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(otelcodes.Error, http.StatusText(code))
+	}
+	span.End()
+}
+
+// startClientSpan 开始对上游实例调用的客户端 span 并将 trace context 写入出站 metadata
+// 调用方透传的 traceparent / tracestate / baggage 头会被替换为当前 span
+func startClientSpan(ctx context.Context, fullMethod, addr string) (context.Context, trace.Span) {
+	service, method, _ := strings.Cut(fullMethod, "/")
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		attrs = append(attrs, attribute.String("server.address", host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, attribute.Int("server.port", p))
+		}
+	} else {
+		attrs = append(attrs, attribute.String("server.address", addr))
+	}
+	ctx, span := tracer.Start(ctx, fullMethod, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for _, k := range propagator.Fields() {
+		delete(md, k)
+	}
+	propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// endClientSpan 记录上游调用的 gRPC 状态码并结束客户端 span
+func endClientSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if code != codes.OK {
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+	span.End()
+}
+
+// metadataCarrier 以 gRPC metadata 承载 trace context
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if vals := metadata.MD(c).Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"pilot/internal/transcoder"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// wsCloseCodeBase gRPC 状态码映射到 WebSocket 应用自定义关闭码区间 4000 + code
+	wsCloseCodeBase = 4000
+	// wsMaxCloseReason 关闭帧 reason 的最大字节数(控制帧负载 125 字节减去 2 字节关闭码)
+	wsMaxCloseReason = 123
+	wsCloseTimeout   = time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsUpgradeMethods WebSocket 握手固定为 GET 流式方法的注解可能使用其他 HTTP 方法
+var wsUpgradeMethods = []string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// isWebSocketUpgrade 判断是否为 WebSocket 升级请求
+func isWebSocketUpgrade(req *http.Request) bool {
+	return websocket.IsWebSocketUpgrade(req)
+}
+
+// matchWebSocket 为 WebSocket 握手匹配客户端流式/双向流式路由
+func (r *HTTPRouter) matchWebSocket(escapedPath string) (*Route, map[string]string, bool, error) {
+	for _, method := range wsUpgradeMethods {
+		route, params, ok, err := r.match(method, escapedPath)
+		if ok && route.MethodDesc.IsClientStreaming() {
+			return route, params, true, err
+		}
+	}
+	return nil, nil, false, nil
+}
+
+// serveWebSocket 将客户端流式/双向流式方法桥接到 WebSocket
+// 每个入站文本帧解析为一条请求消息 空文本帧表示客户端发送完毕(half-close)
+// 每条响应消息作为一个文本帧发送 gRPC 状态通过关闭帧返回:
+// OK 为 1000 其他为 4000+code reason 为状态消息
+func (r *HTTPRouter) serveWebSocket(ctx context.Context, w *responseRecorder, req *http.Request, route *Route, pool *ServicePool, upstream *Upstream) {
+	conn, err := wsUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// Upgrade 失败时已写出 HTTP 错误响应
+		log.Printf("Debug: websocket upgrade failed for %s: %v", route.FullMethod, err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resolver := upstream.invoker.Resolver()
+	unmarshal := protojson.UnmarshalOptions{Resolver: resolver}
+	halfClosed := false
+	nextRequest := func(msg proto.Message) error {
+		if halfClosed {
+			return io.EOF
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			// 客户端关闭或连接异常 取消上游调用
+			cancel()
+			return err
+		}
+		if len(data) == 0 {
+			halfClosed = true
+			// half-close 后继续读取以处理控制帧 并在连接关闭时取消上游调用
+			go func() {
+				for {
+					if _, _, err := conn.NextReader(); err != nil {
+						cancel()
+						return
+					}
+				}
+			}()
+			return io.EOF
+		}
+		if err := unmarshal.Unmarshal(data, msg); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid request message: %v", err)
+		}
+		return nil
+	}
+
+	buf := transcoder.GetBuffer()
+	defer transcoder.PutBuffer(buf)
+	onMessage := func(msg proto.Message) error {
+		b, err := transcoder.AppendResponse((*buf)[:0], msg, route.HttpRule.ResponseBody, resolver)
+		if err != nil {
+			return err
+		}
+		*buf = b
+		return conn.WriteMessage(websocket.TextMessage, b)
+	}
+
+	ctx, span := startClientSpan(ctx, route.FullMethod, upstream.addr)
+	_, err = upstream.invoker.InvokeDuplex(ctx, route.MethodDesc.UnwrapMethod(), nextRequest, onMessage)
+	pool.observeUpstream(upstream, err)
+	endClientSpan(span, err)
+	w.upstreamResult(upstream, err)
+
+	closeCode, reason := websocket.CloseNormalClosure, ""
+	if err != nil {
+		if st, ok := status.FromError(err); ok {
+			closeCode, reason = wsCloseCodeBase+int(st.Code()), st.Message()
+		} else if errors.Is(err, context.Canceled) {
+			closeCode, reason = wsCloseCodeBase+int(codes.Canceled), err.Error()
+		} else {
+			closeCode, reason = wsCloseCodeBase+int(codes.Unknown), err.Error()
+		}
+	}
+	deadline := time.Now().Add(wsCloseTimeout)
+	if werr := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, truncateCloseReason(reason)), deadline); werr != nil {
+		log.Printf("Debug: failed to write websocket close frame for %s: %v", route.FullMethod, werr)
+	}
+}
+
+// truncateCloseReason 按 UTF-8 边界截断关闭帧 reason
+func truncateCloseReason(reason string) string {
+	if len(reason) <= wsMaxCloseReason {
+		return reason
+	}
+	cut := wsMaxCloseReason
+	for cut > 0 && !utf8.RuneStart(reason[cut]) {
+		cut--
+	}
+	return reason[:cut]
+}
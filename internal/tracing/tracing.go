@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// 导出方式
+const (
+	ExporterOTLPGRPC = "otlp_grpc"
+	ExporterOTLPHTTP = "otlp_http"
+	ExporterFile     = "file"
+)
+
+// Config 链路追踪配置
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ServiceName 上报的服务名(service.name)
+	ServiceName string `mapstructure:"service_name"`
+	// Exporter 导出方式 otlp_grpc | otlp_http | file
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint OTLP 接收端地址 如 localhost:4317(gRPC)、localhost:4318(HTTP)
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure 是否以明文连接 OTLP 接收端
+	Insecure bool `mapstructure:"insecure"`
+	// Headers 随 OTLP 请求发送的头 如认证信息
+	Headers map[string]string `mapstructure:"headers"`
+	// File exporter 为 file 时写入的文件 每行一个 JSON 格式的 span
+	File string `mapstructure:"file"`
+	// SampleRatio 根 span 的采样比例 调用方已决定采样时沿用调用方的决定
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// DefaultConfig 默认追踪配置 默认关闭
+func DefaultConfig() Config {
+	return Config{
+		ServiceName: "pilot",
+		Exporter:    ExporterOTLPGRPC,
+		Endpoint:    "localhost:4317",
+		Insecure:    true,
+		SampleRatio: 1,
+	}
+}
+
+// Setup 创建导出器并设置全局 TracerProvider 返回的函数在停机时刷新并关闭导出器
+func Setup(conf Config) (func(context.Context) error, error) {
+	if conf.SampleRatio < 0 || conf.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample_ratio must be between 0 and 1")
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		file     *os.File
+		err      error
+	)
+	switch strings.TrimSpace(conf.Exporter) {
+	case ExporterOTLPGRPC, "":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(conf.Endpoint), otlptracegrpc.WithHeaders(conf.Headers)}
+		if conf.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(conf.Endpoint), otlptracehttp.WithHeaders(conf.Headers)}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case ExporterFile:
+		if conf.File == "" {
+			return nil, fmt.Errorf("file is required for the file exporter")
+		}
+		file, err = os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unsupported exporter %q, expected otlp_grpc, otlp_http or file", conf.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, fmt.Errorf("failed to create %s exporter: %w", conf.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", conf.ServiceName)))
+	if err != nil {
+		res = resource.Default()
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
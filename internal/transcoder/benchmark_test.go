@@ -0,0 +1,191 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+	"github.com/golang/protobuf/jsonpb"
+	protov1 "github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// benchBody 基准测试请求体
+const benchBody = `{"name":"shelves/1/books/1","title":"The Go Programming Language","pages":380,"tags":["go","programming","reference"]}`
+
+// benchEnv 基准测试环境 进程内 gRPC 服务端与连接到它的 invoker
+type benchEnv struct {
+	file    *desc.FileDescriptor
+	method  *desc.MethodDescriptor
+	invoker *GRPCInvoker
+}
+
+// newBenchEnv 启动回显 UpdateBook 请求的进程内 gRPC 服务端
+func newBenchEnv(b *testing.B) *benchEnv {
+	b.Helper()
+	file := parseTestProto(b)
+	method := file.FindService("demo.v1.BookService").FindMethodByName("UpdateBook")
+	input, output := method.GetInputType().UnwrapMessage(), method.GetOutputType().UnwrapMessage()
+
+	// 未注册服务处理器 按 UpdateBookRequest 解码并返回其中的 Book
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		req := dynamicpb.NewMessage(input)
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		resp := dynamicpb.NewMessage(output)
+		if book := input.Fields().ByName("book"); req.Has(book) {
+			resp = req.Get(book).Message().Interface().(*dynamicpb.Message)
+		}
+		resp.Set(output.Fields().ByName("name"), req.Get(input.Fields().ByName("id")))
+		return stream.SendMsg(resp)
+	}))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to listen: %v", err)
+	}
+	go srv.Serve(lis)
+	b.Cleanup(srv.Stop)
+
+	fds := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(file.UnwrapFile())}}
+	set, err := NewDescriptorRegistry().Acquire(DescriptorKey{Service: "demo.v1.BookService", Version: "bench"}, fds)
+	if err != nil {
+		b.Fatalf("failed to acquire descriptors: %v", err)
+	}
+	invoker, err := NewGRPCInvoker(lis.Addr().String(), set, nil)
+	set.Release()
+	if err != nil {
+		b.Fatalf("failed to create invoker: %v", err)
+	}
+	b.Cleanup(func() { invoker.Close() })
+	return &benchEnv{file: file, method: method, invoker: invoker}
+}
+
+func (e *benchEnv) request() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/books/1?version=3", strings.NewReader(benchBody))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+var benchPathParams = map[string]string{"id": "1"}
+
+// BenchmarkInvokeMethod 原 grpcurl 调用路径: 请求构建为 JSON 由 grpcurl 解析为动态消息调用 响应经 jsonpb 编码
+func BenchmarkInvokeMethod(b *testing.B) {
+	env := newBenchEnv(b)
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(env.file)
+	if err != nil {
+		b.Fatalf("failed to create descriptor source: %v", err)
+	}
+	ctx := context.Background()
+	fullMethod := env.method.GetFullyQualifiedName()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		msg, err := DecodeRequest(env.request(), env.method.GetInputType().UnwrapMessage(), benchPathParams, "book", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		jsonInput, err := protojson.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := legacyInvoke(ctx, env.invoker.conn, source, fullMethod, jsonInput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEngineInvoke 直接转码路径: DecodeRequest + Invoke + AppendResponse
+func BenchmarkEngineInvoke(b *testing.B) {
+	env := newBenchEnv(b)
+	ctx := context.Background()
+	method := env.method.UnwrapMethod()
+	resolver := env.invoker.Resolver()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		req, err := DecodeRequest(env.request(), method.Input(), benchPathParams, "book", resolver)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp, err := env.invoker.Invoke(ctx, method, req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf := GetBuffer()
+		if *buf, err = AppendResponse(*buf, resp, "", resolver); err != nil {
+			b.Fatal(err)
+		}
+		PutBuffer(buf)
+	}
+}
+
+// legacyInvoke 原 GRPCInvoker.InvokeMethod 实现 仅作为基准对照
+func legacyInvoke(ctx context.Context, conn *grpc.ClientConn, source grpcurl.DescriptorSource, fullMethod string, jsonInput []byte) ([]byte, error) {
+	var output bytes.Buffer
+	handler := &legacyEventHandler{output: &output}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	headers := make([]string, 0)
+	for k, v := range md {
+		for _, val := range v {
+			headers = append(headers, fmt.Sprintf("%s: %s", k, val))
+		}
+	}
+
+	rf, _, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, source, bytes.NewReader(jsonInput), grpcurl.FormatOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err := grpcurl.InvokeRPC(ctx, source, conn, fullMethod, headers, handler, rf.Next); err != nil {
+		return nil, err
+	}
+	if handler.err != nil {
+		return nil, handler.err
+	}
+	return bytes.TrimRight(output.Bytes(), "\n"), nil
+}
+
+// legacyEventHandler 原 grpcurl 事件处理器
+type legacyEventHandler struct {
+	output    io.Writer
+	err       error
+	marshaler jsonpb.Marshaler
+}
+
+func (h *legacyEventHandler) OnResolveMethod(*desc.MethodDescriptor) {}
+
+func (h *legacyEventHandler) OnSendHeaders(metadata.MD) {}
+
+func (h *legacyEventHandler) OnReceiveHeaders(metadata.MD) {}
+
+func (h *legacyEventHandler) OnReceiveResponse(msg protov1.Message) {
+	h.marshaler.EmitDefaults, h.marshaler.OrigName = true, true
+	s, err := h.marshaler.MarshalToString(msg)
+	if err != nil {
+		h.err = err
+		return
+	}
+	io.WriteString(h.output, s+"\n")
+}
+
+func (h *legacyEventHandler) OnReceiveTrailers(stat *status.Status, _ metadata.MD) {
+	if stat.Code() != codes.OK && h.err == nil {
+		h.err = stat.Err()
+	}
+}
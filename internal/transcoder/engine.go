@@ -0,0 +1,292 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// 直接转码引擎
+// 基于缓存的方法描述符由 HTTP 请求直接构建 dynamicpb 请求消息 响应以 protojson 直接编码
+// 避免 map 中转与多次 JSON 编解码
+
+// TypeResolver 解析 Any 与扩展字段所需的类型解析器
+type TypeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// responseMarshal 响应编码选项 与原 jsonpb 行为保持一致(原始字段名、输出默认值)
+var responseMarshal = protojson.MarshalOptions{
+	UseProtoNames:   true,
+	EmitUnpopulated: true,
+}
+
+// newTypes 由文件描述符构建动态类型注册表
+func newTypes(files []*desc.FileDescriptor) (*dynamicpb.Types, error) {
+	reg := new(protoregistry.Files)
+	seen := make(map[string]struct{})
+	var register func(fd *desc.FileDescriptor) error
+	register = func(fd *desc.FileDescriptor) error {
+		if _, ok := seen[fd.GetName()]; ok {
+			return nil
+		}
+		seen[fd.GetName()] = struct{}{}
+		for _, dep := range fd.GetDependencies() {
+			if err := register(dep); err != nil {
+				return err
+			}
+		}
+		return reg.RegisterFile(fd.UnwrapFile())
+	}
+	for _, fd := range files {
+		if err := register(fd); err != nil {
+			return nil, fmt.Errorf("failed to register file %s: %w", fd.GetName(), err)
+		}
+	}
+	return dynamicpb.NewTypes(reg), nil
+}
+
+// DecodeRequest 由 HTTP 请求直接构建请求消息
+// 依次写入请求体、查询参数、路径参数 路径绑定的字段优先级最高
+// 查询参数仅绑定路径与请求体未覆盖的字段 body 为 * 时不绑定查询参数
+// 参数无法对应字段或取值非法时返回 *ParamError
+func DecodeRequest(r *http.Request, input protoreflect.MessageDescriptor, pathParams map[string]string, bodyField string, resolver TypeResolver) (*dynamicpb.Message, error) {
+	msg := dynamicpb.NewMessage(input)
+	hasBody := r.Method != http.MethodGet && r.Method != http.MethodDelete && bodyField != ""
+
+	// 请求体 protojson 解码会重置消息 因此最先处理
+	if hasBody {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body: %w", err)
+		}
+		defer r.Body.Close()
+
+		if len(body) > 0 {
+			if err := decodeBody(msg, body, bodyField, resolver); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !hasBody || bodyField != "*" {
+		if err := applyQueryParams(msg, r.URL.Query(), boundFields(input, pathParams, bodyField, hasBody)); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyPathParams(msg, pathParams); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// decodeBody 将请求体写入请求消息 bodyField 为 * 时作为完整消息 否则写入指定字段
+func decodeBody(msg *dynamicpb.Message, body []byte, bodyField string, resolver TypeResolver) error {
+	opts := protojson.UnmarshalOptions{Resolver: resolver}
+	if bodyField == "*" {
+		if err := opts.Unmarshal(body, msg); err != nil {
+			return &ParamError{Source: "body", Msg: err.Error()}
+		}
+		return nil
+	}
+
+	fd := findField(msg.Descriptor(), bodyField)
+	if fd == nil {
+		return &ParamError{Source: "body", Msg: fmt.Sprintf("unknown body field %q in %s", bodyField, msg.Descriptor().FullName())}
+	}
+	// 以 {"field": body} 形式解码到临时消息 适用于任意字段类型
+	wrapped := make([]byte, 0, len(body)+len(fd.JSONName())+6)
+	wrapped = append(wrapped, `{"`...)
+	wrapped = append(wrapped, fd.JSONName()...)
+	wrapped = append(wrapped, `":`...)
+	wrapped = append(wrapped, body...)
+	wrapped = append(wrapped, '}')
+	tmp := dynamicpb.NewMessage(msg.Descriptor())
+	if err := opts.Unmarshal(wrapped, tmp); err != nil {
+		return &ParamError{Source: "body", Msg: err.Error()}
+	}
+	// null 与空列表 / 空 map 解码后字段未设置 保持请求消息中该字段未设置
+	if tmp.Has(fd) {
+		msg.Set(fd, tmp.Get(fd))
+	}
+	return nil
+}
+
+// AppendResponse 将响应消息以 JSON 编码追加到 b
+// responseBody 非空时仅编码该字段 字段不存在时编码为 null
+func AppendResponse(b []byte, msg proto.Message, responseBody string, resolver TypeResolver) ([]byte, error) {
+	opts := responseMarshal
+	opts.Resolver = resolver
+	if responseBody == "" {
+		return opts.MarshalAppend(b, msg)
+	}
+
+	m := msg.ProtoReflect()
+	fd := findField(m.Descriptor(), responseBody)
+	if fd == nil {
+		return append(b, "null"...), nil
+	}
+	// 单个消息字段直接编码 其余类型编码完整消息后选取字段
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+		return opts.MarshalAppend(b, m.Get(fd).Message().Interface())
+	}
+	full, err := opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	node, err := sonic.Get(full, string(fd.Name()))
+	if err != nil {
+		return append(b, "null"...), nil
+	}
+	raw, err := node.Raw()
+	if err != nil {
+		return append(b, "null"...), nil
+	}
+	return append(b, raw...), nil
+}
+
+// bufferPool 响应编码缓冲区复用
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// GetBuffer 从缓冲池获取编码缓冲区
+func GetBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// PutBuffer 归还编码缓冲区 过大的缓冲区直接丢弃
+func PutBuffer(b *[]byte) {
+	if cap(*b) > 1<<20 {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// grpcMethodName 将 pkg.Service/Method 转换为 gRPC 调用路径 /pkg.Service/Method
+func grpcMethodName(method protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+}
+
+// Invoke 发起一元调用 返回响应消息 调用超时由 ctx 的截止时间决定
+func (inv *GRPCInvoker) Invoke(ctx context.Context, method protoreflect.MethodDescriptor, req proto.Message) (proto.Message, error) {
+	resp := dynamicpb.NewMessage(method.Output())
+	if err := inv.conn.Invoke(ctx, grpcMethodName(method), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// InvokeServerStream 发起服务端流式调用 每收到一条响应消息即回调 onMessage
+// 不设置默认超时 由调用方上下文控制流的生命周期 返回服务端 trailers
+func (inv *GRPCInvoker) InvokeServerStream(ctx context.Context, method protoreflect.MethodDescriptor, req proto.Message, onMessage func(proto.Message) error) (metadata.MD, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := inv.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, grpcMethodName(method))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp := dynamicpb.NewMessage(method.Output())
+		if err := stream.RecvMsg(resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return stream.Trailer(), nil
+			}
+			return stream.Trailer(), err
+		}
+		if err := onMessage(resp); err != nil {
+			return stream.Trailer(), err
+		}
+	}
+}
+
+// InvokeDuplex 发起客户端流式/双向流式调用
+// nextRequest 每次填充一条请求消息 返回 io.EOF 表示请求发送完毕(half-close)
+// 每收到一条响应消息即回调 onMessage 返回服务端 trailers
+func (inv *GRPCInvoker) InvokeDuplex(ctx context.Context, method protoreflect.MethodDescriptor, nextRequest func(proto.Message) error, onMessage func(proto.Message) error) (metadata.MD, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := inv.conn.NewStream(ctx, &grpc.StreamDesc{
+		ClientStreams: true,
+		ServerStreams: method.IsStreamingServer(),
+	}, grpcMethodName(method))
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送协程 请求读取失败时取消调用并记录原因
+	var sendErr error
+	sendDone := make(chan struct{})
+	go func() {
+		defer close(sendDone)
+		for {
+			req := dynamicpb.NewMessage(method.Input())
+			if err := nextRequest(req); err != nil {
+				if errors.Is(err, io.EOF) {
+					_ = stream.CloseSend()
+					return
+				}
+				sendErr = err
+				cancel()
+				return
+			}
+			if err := stream.SendMsg(req); err != nil {
+				// io.EOF 表示服务端已结束流 真实状态由 RecvMsg 返回
+				return
+			}
+		}
+	}()
+
+	for {
+		resp := dynamicpb.NewMessage(method.Output())
+		err := stream.RecvMsg(resp)
+		if err == nil {
+			if err := onMessage(resp); err != nil {
+				cancel()
+				<-sendDone
+				return stream.Trailer(), err
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		if status.Code(err) == codes.Canceled {
+			cancel()
+			<-sendDone
+			if sendErr != nil {
+				err = sendErr
+			}
+		}
+		return stream.Trailer(), err
+	}
+}
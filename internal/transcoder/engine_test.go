@@ -0,0 +1,231 @@
+package transcoder
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testProto 测试用服务定义
+const testProto = `syntax = "proto3";
+package demo.v1;
+
+message Book {
+  string name = 1;
+  string title = 2;
+  int32 pages = 3;
+  repeated string tags = 4;
+}
+
+message UpdateBookRequest {
+  string id = 1;
+  Book book = 2;
+  int32 version = 3;
+  string etag = 4;
+  repeated string labels = 5;
+  map<string, string> attrs = 6;
+}
+
+service BookService {
+  rpc UpdateBook(UpdateBookRequest) returns (Book);
+}
+`
+
+// parseTestProto 解析 testProto
+func parseTestProto(tb testing.TB) *desc.FileDescriptor {
+	tb.Helper()
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"demo.proto": testProto}),
+	}
+	files, err := parser.ParseFiles("demo.proto")
+	if err != nil {
+		tb.Fatalf("failed to parse test proto: %v", err)
+	}
+	return files[0]
+}
+
+func TestDecodeRequestBinding(t *testing.T) {
+	input := parseTestProto(t).FindMessage("demo.v1.UpdateBookRequest").UnwrapMessage()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		bodyField  string
+		pathParams map[string]string
+		want       string
+	}{
+		{
+			name:   "query only",
+			method: "GET",
+			target: "/v1/books/1?version=3&book.tags=a&book.tags=b",
+			want:   `{"book":{"tags":["a","b"]},"version":3}`,
+		},
+		{
+			name:       "path overrides query",
+			method:     "GET",
+			target:     "/v1/books/1?id=2&etag=x",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","etag":"x"}`,
+		},
+		{
+			name:       "body star ignores query",
+			method:     "POST",
+			target:     "/v1/books/1?version=9&etag=q",
+			body:       `{"version":1,"book":{"title":"t"}}`,
+			bodyField:  "*",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","book":{"title":"t"},"version":1}`,
+		},
+		{
+			name:       "body field ignores query on covered fields",
+			method:     "PATCH",
+			target:     "/v1/books/1?book.title=q&book=x&version=5",
+			body:       `{"title":"t"}`,
+			bodyField:  "book",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","book":{"title":"t"},"version":5}`,
+		},
+		{
+			name:       "query ignores fields under nested path binding",
+			method:     "GET",
+			target:     "/v1/books/n?book.name=q&book.pages=3",
+			pathParams: map[string]string{"book.name": "n"},
+			want:       `{"book":{"name":"n","pages":3}}`,
+		},
+		{
+			name:       "query ignores parents of nested path binding",
+			method:     "GET",
+			target:     "/v1/books/n?book=q",
+			pathParams: map[string]string{"book.name": "n"},
+			want:       `{"book":{"name":"n"}}`,
+		},
+		{
+			name:       "null message body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `null`,
+			bodyField:  "book",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "message body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `{"title":"t"}`,
+			bodyField:  "book",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","book":{"title":"t"}}`,
+		},
+		{
+			name:       "null repeated body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `null`,
+			bodyField:  "labels",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "empty repeated body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `[]`,
+			bodyField:  "labels",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "repeated body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `["a","b"]`,
+			bodyField:  "labels",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","labels":["a","b"]}`,
+		},
+		{
+			name:       "null map body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `null`,
+			bodyField:  "attrs",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "empty map body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `{}`,
+			bodyField:  "attrs",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:       "map body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `{"k":"v"}`,
+			bodyField:  "attrs",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1","attrs":{"k":"v"}}`,
+		},
+		{
+			name:       "null scalar body",
+			method:     "POST",
+			target:     "/v1/books/1",
+			body:       `null`,
+			bodyField:  "etag",
+			pathParams: map[string]string{"id": "1"},
+			want:       `{"id":"1"}`,
+		},
+		{
+			name:      "body star on GET keeps query",
+			method:    "GET",
+			target:    "/v1/books?version=2",
+			bodyField: "*",
+			want:      `{"version":2}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			msg, err := DecodeRequest(req, input, tt.pathParams, tt.bodyField, nil)
+			if err != nil {
+				t.Fatalf("DecodeRequest() error = %v", err)
+			}
+			assertMessageJSON(t, input, msg.Interface(), tt.want)
+		})
+	}
+}
+
+func TestDecodeRequestUnknownQuery(t *testing.T) {
+	input := parseTestProto(t).FindMessage("demo.v1.UpdateBookRequest").UnwrapMessage()
+	req := httptest.NewRequest("GET", "/v1/books/1?missing=1", nil)
+	_, err := DecodeRequest(req, input, map[string]string{"id": "1"}, "", nil)
+	if pe, ok := err.(*ParamError); !ok || pe.Source != "query" || pe.Param != "missing" {
+		t.Fatalf("DecodeRequest() error = %v, want query ParamError for missing", err)
+	}
+}
+
+// assertMessageJSON 比较消息与期望 JSON 表示的消息
+func assertMessageJSON(t *testing.T, md protoreflect.MessageDescriptor, got proto.Message, want string) {
+	t.Helper()
+	expected := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(want), expected); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", want, err)
+	}
+	if !proto.Equal(got, expected) {
+		t.Errorf("message = %v, want %s", got, want)
+	}
+}
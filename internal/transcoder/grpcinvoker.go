@@ -1,34 +1,53 @@
 package transcoder
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"net/http"
+	"sync"
 	"time"
 
-	"github.com/bytedance/sonic"
-	"github.com/fullstorydev/grpcurl"
 	"github.com/jhump/protoreflect/desc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 type GRPCInvoker struct {
-	conn             *grpc.ClientConn
-	descriptorSource grpcurl.DescriptorSource
-	address          string
+	conn        *grpc.ClientConn
+	descriptors *DescriptorSet // 共享描述符集 持有一次引用
+	address     string
+	closed      bool
+	mu          sync.RWMutex // 保护 descriptors 的热更新
 }
 
-// NewGRPCInvoker 创建一个GRPCInvoker实例
-func NewGRPCInvoker(address string, fds *descriptorpb.FileDescriptorSet) (*GRPCInvoker, []*desc.FileDescriptor, error) {
+// CreateFileDescriptors 将FileDescriptorSet转换为FileDescriptor列表
+func CreateFileDescriptors(fds *descriptorpb.FileDescriptorSet) ([]*desc.FileDescriptor, error) {
+	filesMap, err := desc.CreateFileDescriptorsFromSet(fds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file descriptors: %w", err)
+	}
+
+	// 将map转换为slice
+	files := make([]*desc.FileDescriptor, 0, len(filesMap))
+	for _, fd := range filesMap {
+		files = append(files, fd)
+	}
+	return files, nil
+}
+
+// NewGRPCInvoker 创建一个GRPCInvoker实例 引用共享描述符集 set
+// creds 为 nil 时使用明文连接
+func NewGRPCInvoker(address string, set *DescriptorSet, creds credentials.TransportCredentials) (*GRPCInvoker, error) {
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
 	conn, err := grpc.NewClient(
 		address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
 			Time:                30 * time.Second,
 			Timeout:             10 * time.Second,
@@ -38,167 +57,68 @@ func NewGRPCInvoker(address string, fds *descriptorpb.FileDescriptorSet) (*GRPCI
 			grpc.MaxCallRecvMsgSize(24*1024*1024),
 			grpc.MaxCallSendMsgSize(24*1024*1024),
 		),
-		grpc.WithDefaultServiceConfig(`{
-			"loadBalancingPolicy": "round_robin",
-            "methodConfig": [{
-                "name": [{"service": ""}],
-                "waitForReady": true,
-                "retryPolicy": {
-                    "maxAttempts": 3,
-                    "initialBackoff": "0.1s",
-                    "maxBackoff": "1s",
-                    "backoffMultiplier": 1.3,
-                    "retryableStatusCodes": ["UNAVAILABLE", "RESOURCE_EXHAUSTED", "INTERNAL"]
-				}
-			}]
-		}`),
+		// 重试由网关按路由策略跨实例执行 连接不可用时快速失败以便换用其他实例
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "round_robin"}`),
 		grpc.WithConnectParams(grpc.ConnectParams{MinConnectTimeout: 10 * time.Second}),
 	)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to connect to %s: %w", address, err)
-	}
-
-	// 将FileDescriptorSet转换为FileDescriptor
-	filesMap, err := desc.CreateFileDescriptorsFromSet(fds)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create file descriptors: %w", err)
-	}
-
-	// 将map转换为slice
-	files := make([]*desc.FileDescriptor, 0, len(filesMap))
-	for _, fd := range filesMap {
-		files = append(files, fd)
-	}
-
-	descSource, err := grpcurl.DescriptorSourceFromFileDescriptors(files...)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create descriptor source: %w", err)
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
 
+	set.Retain()
 	return &GRPCInvoker{
-		conn:             conn,
-		descriptorSource: descSource,
-		address:          address,
-	}, files, nil
+		conn:        conn,
+		descriptors: set,
+		address:     address,
+	}, nil
 }
 
-// InvokeMethod 调用gRPC方法
-func (inv *GRPCInvoker) InvokeMethod(ctx context.Context, fullMethod string, jsonInput []byte) ([]byte, error) {
-	if _, ok := ctx.Deadline(); !ok {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-	}
-	// 构造请求读取器，避免重复编解码
-	var requestReader io.Reader
-	if len(jsonInput) > 0 {
-		requestReader = bytes.NewReader(jsonInput)
-	} else {
-		requestReader = bytes.NewReader([]byte("{}"))
-	}
-
-	// 创建输出缓冲区
-	var output bytes.Buffer
-
-	// 创建事件处理器
-	handler := &grpcurlEventHandler{
-		output: &output,
-	}
-
-	// 从上下文中获取gRPC元数据
-	md, _ := metadata.FromOutgoingContext(ctx)
-	headers := make([]string, 0)
-	for k, v := range md {
-		for _, val := range v {
-			headers = append(headers, fmt.Sprintf("%s: %s", k, val))
-		}
-	}
-
-	// 创建请求解析器和格式化器
-	rf, _, err := grpcurl.RequestParserAndFormatter(
-		grpcurl.FormatJSON,
-		inv.descriptorSource,
-		requestReader,
-		grpcurl.FormatOptions{},
-	)
-	if err != nil {
-		return nil, err
+// UpdateDescriptors 切换到新的共享描述符集 后续调用使用新的请求/响应定义
+func (inv *GRPCInvoker) UpdateDescriptors(set *DescriptorSet) {
+	inv.mu.Lock()
+	if inv.closed {
+		inv.mu.Unlock()
+		return
 	}
+	set.Retain()
+	old := inv.descriptors
+	inv.descriptors = set
+	inv.mu.Unlock()
+	old.Release()
+}
 
-	// 执行gRPC调用
-	err = grpcurl.InvokeRPC(
-		ctx,
-		inv.descriptorSource,
-		inv.conn,
-		fullMethod,
-		headers,
-		handler,
-		rf.Next,
-	)
+// Resolver 获取当前类型解析器 用于请求/响应编解码中的 Any 类型
+func (inv *GRPCInvoker) Resolver() TypeResolver {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return inv.descriptors.types
+}
 
+// CheckHealth 通过标准 grpc.health.v1.Health/Check 探测实例 service 为空表示检查整个服务端
+func (inv *GRPCInvoker) CheckHealth(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	resp, err := healthpb.NewHealthClient(inv.conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service}, grpc.WaitForReady(false))
 	if err != nil {
-		return nil, err
-	}
-
-	if handler.err != nil {
-		return nil, handler.err
+		return healthpb.HealthCheckResponse_UNKNOWN, err
 	}
-
-	return bytes.TrimRight(output.Bytes(), "\n"), nil
+	return resp.GetStatus(), nil
 }
 
-// Close 关闭gRPC连接
-func (inv *GRPCInvoker) Close() error {
-	return inv.conn.Close()
+// State 连接状态 IDLE / CONNECTING / READY / TRANSIENT_FAILURE / SHUTDOWN
+func (inv *GRPCInvoker) State() connectivity.State {
+	return inv.conn.GetState()
 }
 
-// BuildRequestJSON 构建请求JSON数据
-func BuildRequestJSON(r *http.Request, pathParams map[string]string, bodyField string) ([]byte, error) {
-	requestMap := make(map[string]any)
-
-	// 添加请求路径参数
-	for key, value := range pathParams {
-		requestMap[key] = value
-	}
-
-	// 添加查询参数
-	for key, values := range r.URL.Query() {
-		if len(values) == 1 {
-			requestMap[key] = values[0]
-		} else {
-			requestMap[key] = values
-		}
-	}
-
-	// 添加请求体参数
-	if r.Method != "GET" && r.Method != "DELETE" {
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read body: %w", err)
-		}
-		defer r.Body.Close()
-
-		if len(body) > 0 {
-			if bodyField == "*" {
-				// protobuf中定义的body为 * 就需要合并所有参数
-				var bodyMap map[string]any
-				if err := sonic.Unmarshal(body, &bodyMap); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal body: %w", err)
-				}
-				// body、路径参数、查询参数合并 body 优先覆盖
-				for k, v := range bodyMap {
-					requestMap[k] = v
-				}
-			} else if bodyField != "" {
-				// protobuf中定义的body为 特定字段名 就需要合并到特定字段中
-				var bodyData any
-				if err := sonic.Unmarshal(body, &bodyData); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal body: %w", err)
-				}
-				requestMap[bodyField] = bodyData
-			}
-		}
+// Close 关闭gRPC连接 并释放描述符集引用
+// 进行中的请求仍可读取描述符 描述符集仅从注册表移除
+func (inv *GRPCInvoker) Close() error {
+	inv.mu.Lock()
+	if inv.closed {
+		inv.mu.Unlock()
+		return nil
 	}
-
-	return sonic.Marshal(requestMap)
+	inv.closed = true
+	set := inv.descriptors
+	inv.mu.Unlock()
+	set.Release()
+	return inv.conn.Close()
 }
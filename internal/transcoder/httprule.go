@@ -3,15 +3,20 @@ package transcoder
 import (
 	"fmt"
 
+	gatewayv1 "pilot/proto/pilot/gateway/v1"
+
 	"github.com/jhump/protoreflect/desc"
 	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/proto"
 )
 
 type HTTPRule struct {
-	Method string // http方法
-	Path   string // 请求路径
-	Body   string // body字段 为*时表示合并所有参数
+	Method       string            // http方法
+	Path         string            // 请求路径
+	Body         string            // body字段 为*时表示合并所有参数
+	ResponseBody string            // response_body字段 非空时仅返回响应消息中的该字段
+	Template     *PathTemplate     // 解析后的路径模板
+	Policy       *gatewayv1.Policy // 方法声明的网关策略 未声明时为 nil 同一方法的各绑定共享
 }
 
 // ExtractHTTPRules 从方法描述符中提取HTTP规则
@@ -35,6 +40,7 @@ func ExtractHTTPRules(method *desc.MethodDescriptor) ([]*HTTPRule, error) {
 	}
 
 	rules := make([]*HTTPRule, 0)
+	policy := extractPolicy(method)
 
 	// 解析主要规则
 	mainRule, err := parseHTTPRule(httpRule)
@@ -42,6 +48,7 @@ func ExtractHTTPRules(method *desc.MethodDescriptor) ([]*HTTPRule, error) {
 		return nil, fmt.Errorf("failed to parse HTTP rule: %w", err)
 	}
 	if mainRule != nil {
+		mainRule.Policy = policy
 		rules = append(rules, mainRule)
 	}
 
@@ -52,6 +59,7 @@ func ExtractHTTPRules(method *desc.MethodDescriptor) ([]*HTTPRule, error) {
 			return nil, fmt.Errorf("failed to parse additional binding: %w", err)
 		}
 		if rule != nil {
+			rule.Policy = policy
 			rules = append(rules, rule)
 		}
 	}
@@ -59,6 +67,25 @@ func ExtractHTTPRules(method *desc.MethodDescriptor) ([]*HTTPRule, error) {
 	return rules, nil
 }
 
+// extractPolicy 提取方法的网关策略 method_policy 覆盖所属服务的 service_policy
+func extractPolicy(method *desc.MethodDescriptor) *gatewayv1.Policy {
+	var policy *gatewayv1.Policy
+	if opts := method.GetService().GetServiceOptions(); opts != nil && proto.HasExtension(opts, gatewayv1.E_ServicePolicy) {
+		if p, ok := proto.GetExtension(opts, gatewayv1.E_ServicePolicy).(*gatewayv1.Policy); ok && p != nil {
+			policy = proto.Clone(p).(*gatewayv1.Policy)
+		}
+	}
+	if opts := method.GetMethodOptions(); opts != nil && proto.HasExtension(opts, gatewayv1.E_MethodPolicy) {
+		if p, ok := proto.GetExtension(opts, gatewayv1.E_MethodPolicy).(*gatewayv1.Policy); ok && p != nil {
+			if policy == nil {
+				policy = &gatewayv1.Policy{}
+			}
+			proto.Merge(policy, p)
+		}
+	}
+	return policy
+}
+
 // parseHTTPRule 解析单个HTTP规则
 func parseHTTPRule(rule *annotations.HttpRule) (*HTTPRule, error) {
 	if rule == nil {
@@ -66,7 +93,8 @@ func parseHTTPRule(rule *annotations.HttpRule) (*HTTPRule, error) {
 	}
 
 	httpRule := &HTTPRule{
-		Body: rule.Body,
+		Body:         rule.Body,
+		ResponseBody: rule.ResponseBody,
 	}
 
 	// 解析HTTP方法和路径
@@ -93,5 +121,12 @@ func parseHTTPRule(rule *annotations.HttpRule) (*HTTPRule, error) {
 		return nil, fmt.Errorf("unknown HTTP rule pattern type")
 	}
 
+	// 解析路径模板
+	tpl, err := ParsePathTemplate(httpRule.Path)
+	if err != nil {
+		return nil, err
+	}
+	httpRule.Template = tpl
+
 	return httpRule, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,411 @@
+package transcoder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ParamError 请求参数(path/query/body)错误 对应 HTTP 400
+type ParamError struct {
+	Source string // "path"、"query" 或 "body"
+	Param  string
+	Msg    string
+}
+
+func (e *ParamError) Error() string {
+	if e.Param == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Source, e.Msg)
+	}
+	return fmt.Sprintf("invalid %s parameter %q: %s", e.Source, e.Param, e.Msg)
+}
+
+// wrapperTypes google.protobuf 包装类型
+var wrapperTypes = map[protoreflect.FullName]struct{}{
+	"google.protobuf.DoubleValue": {},
+	"google.protobuf.FloatValue":  {},
+	"google.protobuf.Int64Value":  {},
+	"google.protobuf.UInt64Value": {},
+	"google.protobuf.Int32Value":  {},
+	"google.protobuf.UInt32Value": {},
+	"google.protobuf.BoolValue":   {},
+	"google.protobuf.StringValue": {},
+	"google.protobuf.BytesValue":  {},
+}
+
+// paramTarget 参数解析结果 字段路径与目标字段
+type paramTarget struct {
+	path   []protoreflect.FieldDescriptor
+	mapKey string
+	hasKey bool
+}
+
+func (t *paramTarget) field() protoreflect.FieldDescriptor {
+	return t.path[len(t.path)-1]
+}
+
+// findField 按原始字段名或 json_name 查找字段
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+// resolveParam 将 a.b.c 或 a.b.labels[key] 形式的参数名解析到输入消息的字段
+// 字段名同时接受原始字段名与 json_name
+func resolveParam(input protoreflect.MessageDescriptor, name string) (*paramTarget, error) {
+	target := &paramTarget{}
+	if idx := strings.IndexByte(name, '['); idx >= 0 {
+		if !strings.HasSuffix(name, "]") {
+			return nil, fmt.Errorf("malformed map key")
+		}
+		target.mapKey = name[idx+1 : len(name)-1]
+		target.hasKey = true
+		name = name[:idx]
+	}
+
+	parts := strings.Split(name, ".")
+	md := input
+	for i, part := range parts {
+		fd := findField(md, part)
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q in %s", part, md.FullName())
+		}
+		target.path = append(target.path, fd)
+		if i < len(parts)-1 {
+			if fd.IsList() || fd.IsMap() || fd.Message() == nil || isScalarMessage(fd.Message()) {
+				return nil, fmt.Errorf("field %q cannot have nested fields", strings.Join(parts[:i+1], "."))
+			}
+			md = fd.Message()
+		}
+	}
+
+	fd := target.field()
+	if target.hasKey && !fd.IsMap() {
+		return nil, fmt.Errorf("field %q is not a map", name)
+	}
+	if !target.hasKey && fd.IsMap() {
+		return nil, fmt.Errorf("map field %q requires a key, e.g. %s[key]=value", name, name)
+	}
+	return target, nil
+}
+
+// boundFields 路径参数与请求体已绑定的字段路径 无法解析的路径参数忽略 由 applyPathParams 报错
+func boundFields(input protoreflect.MessageDescriptor, pathParams map[string]string, bodyField string, hasBody bool) [][]protoreflect.FieldDescriptor {
+	bound := make([][]protoreflect.FieldDescriptor, 0, len(pathParams)+1)
+	for fieldPath := range pathParams {
+		if target, err := resolveParam(input, fieldPath); err == nil {
+			bound = append(bound, target.path)
+		}
+	}
+	if hasBody && bodyField != "*" {
+		if fd := findField(input, bodyField); fd != nil {
+			bound = append(bound, []protoreflect.FieldDescriptor{fd})
+		}
+	}
+	return bound
+}
+
+// overlaps 两个字段路径是否重叠(其一为另一个的前缀)
+func overlaps(a, b []protoreflect.FieldDescriptor) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyQueryParams 将查询参数按输入消息描述符转换类型后写入请求消息
+// 支持 a.b.c 嵌套字段、重复键表示 repeated 字段、labels[key] 表示 map 字段
+// 与 bound 中字段路径重叠的参数忽略
+func applyQueryParams(msg protoreflect.Message, query map[string][]string, bound [][]protoreflect.FieldDescriptor) error {
+	for name, values := range query {
+		target, err := resolveParam(msg.Descriptor(), name)
+		if err != nil {
+			return &ParamError{Source: "query", Param: name, Msg: err.Error()}
+		}
+		if slices.ContainsFunc(bound, func(path []protoreflect.FieldDescriptor) bool { return overlaps(target.path, path) }) {
+			continue
+		}
+		if err := applyParam(msg, target, values); err != nil {
+			return &ParamError{Source: "query", Param: name, Msg: err.Error()}
+		}
+	}
+	return nil
+}
+
+// applyPathParams 将路径参数按输入消息描述符转换类型后写入请求消息
+func applyPathParams(msg protoreflect.Message, pathParams map[string]string) error {
+	for fieldPath, value := range pathParams {
+		target, err := resolveParam(msg.Descriptor(), fieldPath)
+		if err != nil {
+			return &ParamError{Source: "path", Param: fieldPath, Msg: err.Error()}
+		}
+		if fd := target.field(); fd.IsList() || fd.IsMap() {
+			return &ParamError{Source: "path", Param: fieldPath, Msg: "path parameters cannot bind repeated or map fields"}
+		}
+		if err := applyParam(msg, target, []string{value}); err != nil {
+			return &ParamError{Source: "path", Param: fieldPath, Msg: err.Error()}
+		}
+	}
+	return nil
+}
+
+// applyParam 转换参数值并写入目标字段 中间层消息按需创建
+func applyParam(msg protoreflect.Message, target *paramTarget, values []string) error {
+	m := msg
+	for _, fd := range target.path[:len(target.path)-1] {
+		m = m.Mutable(fd).Message()
+	}
+	fd := target.field()
+
+	switch {
+	case fd.IsMap():
+		if len(values) > 1 {
+			return fmt.Errorf("multiple values for map entry")
+		}
+		key, err := convertValue(fd.MapKey(), target.mapKey, nil)
+		if err != nil {
+			return fmt.Errorf("invalid map key: %w", err)
+		}
+		entries := m.Mutable(fd).Map()
+		v, err := convertValue(fd.MapValue(), values[0], entries.NewValue)
+		if err != nil {
+			return err
+		}
+		entries.Set(key.MapKey(), v)
+
+	case fd.IsList():
+		list := m.Mutable(fd).List()
+		for _, raw := range values {
+			v, err := convertValue(fd, raw, list.NewElement)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+
+	default:
+		if len(values) > 1 {
+			return fmt.Errorf("multiple values for non-repeated field")
+		}
+		v, err := convertValue(fd, values[0], func() protoreflect.Value { return m.NewField(fd) })
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+// convertValue 按字段类型将字符串参数转换为字段值
+// newMessage 用于为消息类型字段创建与容器匹配的消息实例
+func convertValue(fd protoreflect.FieldDescriptor, raw string, newMessage func() protoreflect.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(raw), nil
+
+	case protoreflect.BytesKind:
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if b, err := enc.DecodeString(raw); err == nil {
+				return protoreflect.ValueOfBytes(b), nil
+			}
+		}
+		return protoreflect.Value{}, fmt.Errorf("invalid base64 value %q for bytes field", raw)
+
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid bool value %q", raw)
+		}
+		return protoreflect.ValueOfBool(v), nil
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int32 value %q", raw)
+		}
+		return protoreflect.ValueOfInt32(int32(v)), nil
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint32 value %q", raw)
+		}
+		return protoreflect.ValueOfUint32(uint32(v)), nil
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int64 value %q", raw)
+		}
+		return protoreflect.ValueOfInt64(v), nil
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint64 value %q", raw)
+		}
+		return protoreflect.ValueOfUint64(v), nil
+
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		bitSize := 64
+		if fd.Kind() == protoreflect.FloatKind {
+			bitSize = 32
+		}
+		v, err := parseFloat(raw, bitSize)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		if bitSize == 32 {
+			return protoreflect.ValueOfFloat32(float32(v)), nil
+		}
+		return protoreflect.ValueOfFloat64(v), nil
+
+	case protoreflect.EnumKind:
+		enum := fd.Enum()
+		if n, err := strconv.ParseInt(raw, 10, 32); err == nil {
+			if enum.Values().ByNumber(protoreflect.EnumNumber(n)) == nil {
+				return protoreflect.Value{}, fmt.Errorf("invalid value %d for enum %s", n, enum.FullName())
+			}
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+		}
+		ev := enum.Values().ByName(protoreflect.Name(raw))
+		if ev == nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid value %q for enum %s", raw, enum.FullName())
+		}
+		return protoreflect.ValueOfEnum(ev.Number()), nil
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return convertWellKnown(fd.Message(), raw, newMessage)
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
+
+// convertWellKnown 转换可由单个字符串表示的 well-known 类型
+// 先转换为其 JSON 表示 再交由 protojson 构造消息
+func convertWellKnown(md protoreflect.MessageDescriptor, raw string, newMessage func() protoreflect.Value) (protoreflect.Value, error) {
+	var literal string
+	switch name := md.FullName(); name {
+	case "google.protobuf.Timestamp":
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 format", raw)
+		}
+		literal = strconv.Quote(t.UTC().Format(time.RFC3339Nano))
+
+	case "google.protobuf.Duration":
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid duration %q, expected e.g. 1.5s", raw)
+		}
+		literal = strconv.Quote(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s")
+
+	case "google.protobuf.FieldMask":
+		paths := strings.Split(raw, ",")
+		for i, p := range paths {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				return protoreflect.Value{}, fmt.Errorf("invalid field mask %q", raw)
+			}
+			paths[i] = lowerCamelPath(p)
+		}
+		literal = strconv.Quote(strings.Join(paths, ","))
+
+	default:
+		if _, ok := wrapperTypes[name]; !ok {
+			return protoreflect.Value{}, fmt.Errorf("message type %s cannot be set from a parameter", name)
+		}
+		inner, err := convertValue(md.Fields().ByName("value"), raw, nil)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		literal = wrapperLiteral(md.Fields().ByName("value").Kind(), inner)
+	}
+
+	v := newMessage()
+	if err := protojson.Unmarshal([]byte(literal), v.Message().Interface()); err != nil {
+		return protoreflect.Value{}, fmt.Errorf("invalid %s value %q: %v", md.FullName(), raw, err)
+	}
+	return v, nil
+}
+
+// wrapperLiteral 生成包装类型内部值的 JSON 表示
+func wrapperLiteral(kind protoreflect.Kind, v protoreflect.Value) string {
+	switch kind {
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(base64.StdEncoding.EncodeToString(v.Bytes()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return `"NaN"`
+		case math.IsInf(f, 1):
+			return `"Infinity"`
+		case math.IsInf(f, -1):
+			return `"-Infinity"`
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case protoreflect.Int64Kind, protoreflect.Uint64Kind:
+		return strconv.Quote(v.String())
+	}
+	return v.String()
+}
+
+// parseFloat 解析浮点数 兼容 protobuf JSON 中的 NaN/Infinity 表示
+func parseFloat(raw string, bitSize int) (float64, error) {
+	switch raw {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+	v, err := strconv.ParseFloat(raw, bitSize)
+	if err != nil || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid number value %q", raw)
+	}
+	return v, nil
+}
+
+// isScalarMessage 判断消息类型是否以单个 JSON 标量表示
+func isScalarMessage(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return true
+	}
+	_, ok := wrapperTypes[md.FullName()]
+	return ok
+}
+
+// lowerCamelPath 将 FieldMask 路径 a_b.c_d 转换为 JSON 形式 aB.cD
+func lowerCamelPath(p string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range p {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
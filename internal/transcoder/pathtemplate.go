@@ -0,0 +1,234 @@
+package transcoder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SegmentKind 路径模板段类型
+type SegmentKind uint8
+
+const (
+	SegmentLiteral      SegmentKind = iota // 字面量
+	SegmentWildcard                        // * 匹配单个段
+	SegmentDeepWildcard                    // ** 匹配剩余所有段
+)
+
+// PathSegment 路径模板中的单个段
+type PathSegment struct {
+	Kind    SegmentKind
+	Literal string
+}
+
+// PathVariable 路径变量 绑定到请求消息字段(支持 a.b.c 嵌套字段)
+// 覆盖 Segments[Start:End] 范围内的段
+type PathVariable struct {
+	FieldPath string
+	Start     int
+	End       int
+}
+
+// PathTemplate 解析后的 google.api.http 路径模板
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	FieldPath = IDENT { "." IDENT } ;
+//	Verb     = ":" LITERAL ;
+type PathTemplate struct {
+	Template  string
+	Segments  []PathSegment
+	Variables []PathVariable
+	Verb      string
+}
+
+// ParsePathTemplate 解析路径模板
+func ParsePathTemplate(template string) (*PathTemplate, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("path template %q must start with '/'", template)
+	}
+
+	tpl := &PathTemplate{Template: template}
+	// 容忍末尾多余的斜杠
+	if len(template) > 1 {
+		template = strings.TrimSuffix(template, "/")
+	}
+	p := &templateParser{input: template, pos: 1}
+
+	// 根路径 "/" 或 "/:verb"
+	if p.eof() || p.peek() == ':' {
+		if err := p.parseVerb(tpl); err != nil {
+			return nil, err
+		}
+		return tpl, nil
+	}
+
+	if err := p.parseSegments(tpl, false); err != nil {
+		return nil, err
+	}
+	if err := p.parseVerb(tpl); err != nil {
+		return nil, err
+	}
+
+	// ** 只允许出现在最后一段
+	for i, seg := range tpl.Segments {
+		if seg.Kind == SegmentDeepWildcard && i != len(tpl.Segments)-1 {
+			return nil, fmt.Errorf("path template %q: '**' must be the last segment", template)
+		}
+	}
+
+	// 同一字段不允许重复绑定
+	seen := make(map[string]struct{}, len(tpl.Variables))
+	for _, v := range tpl.Variables {
+		if _, dup := seen[v.FieldPath]; dup {
+			return nil, fmt.Errorf("path template %q: field %q bound more than once", template, v.FieldPath)
+		}
+		seen[v.FieldPath] = struct{}{}
+	}
+
+	return tpl, nil
+}
+
+// templateParser 路径模板递归下降解析器
+type templateParser struct {
+	input string
+	pos   int
+}
+
+func (p *templateParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *templateParser) peek() byte {
+	return p.input[p.pos]
+}
+
+func (p *templateParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("path template %q at offset %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+// parseSegments 解析以 '/' 分隔的段 inVariable 表示位于 {field=...} 内部
+func (p *templateParser) parseSegments(tpl *PathTemplate, inVariable bool) error {
+	for {
+		if err := p.parseSegment(tpl, inVariable); err != nil {
+			return err
+		}
+		if p.eof() || p.peek() != '/' {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *templateParser) parseSegment(tpl *PathTemplate, inVariable bool) error {
+	if p.eof() {
+		return p.errorf("unexpected end of template, expected segment")
+	}
+
+	switch p.peek() {
+	case '*':
+		if strings.HasPrefix(p.input[p.pos:], "**") {
+			p.pos += 2
+			tpl.Segments = append(tpl.Segments, PathSegment{Kind: SegmentDeepWildcard})
+		} else {
+			p.pos++
+			tpl.Segments = append(tpl.Segments, PathSegment{Kind: SegmentWildcard})
+		}
+		return nil
+	case '{':
+		if inVariable {
+			return p.errorf("nested variables are not allowed")
+		}
+		return p.parseVariable(tpl)
+	}
+
+	literal := p.parseLiteral()
+	if literal == "" {
+		return p.errorf("unexpected character %q", p.peek())
+	}
+	tpl.Segments = append(tpl.Segments, PathSegment{Kind: SegmentLiteral, Literal: literal})
+	return nil
+}
+
+func (p *templateParser) parseVariable(tpl *PathTemplate) error {
+	// 跳过 '{'
+	p.pos++
+	start := p.pos
+	for !p.eof() && p.peek() != '=' && p.peek() != '}' {
+		p.pos++
+	}
+	if p.eof() {
+		return p.errorf("unterminated variable")
+	}
+	fieldPath := p.input[start:p.pos]
+	if err := validateFieldPath(fieldPath); err != nil {
+		return p.errorf("%v", err)
+	}
+
+	v := PathVariable{FieldPath: fieldPath, Start: len(tpl.Segments)}
+	if p.peek() == '=' {
+		p.pos++
+		if err := p.parseSegments(tpl, true); err != nil {
+			return err
+		}
+	} else {
+		// {field} 等价于 {field=*}
+		tpl.Segments = append(tpl.Segments, PathSegment{Kind: SegmentWildcard})
+	}
+	if p.eof() || p.peek() != '}' {
+		return p.errorf("expected '}'")
+	}
+	p.pos++
+	v.End = len(tpl.Segments)
+	tpl.Variables = append(tpl.Variables, v)
+	return nil
+}
+
+func (p *templateParser) parseVerb(tpl *PathTemplate) error {
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != ':' {
+		return p.errorf("unexpected character %q", p.peek())
+	}
+	p.pos++
+	verb := p.parseLiteral()
+	if verb == "" || !p.eof() {
+		return p.errorf("invalid verb")
+	}
+	tpl.Verb = verb
+	return nil
+}
+
+// parseLiteral 读取字面量 遇到分隔符停止
+func (p *templateParser) parseLiteral() string {
+	start := p.pos
+	for !p.eof() {
+		switch p.peek() {
+		case '/', '{', '}', '=', ':', '*':
+			return p.input[start:p.pos]
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// validateFieldPath 校验 a.b.c 形式的字段路径
+func validateFieldPath(fieldPath string) error {
+	if fieldPath == "" {
+		return fmt.Errorf("empty field path")
+	}
+	for ident := range strings.SplitSeq(fieldPath, ".") {
+		if ident == "" {
+			return fmt.Errorf("invalid field path %q", fieldPath)
+		}
+		for i, c := range ident {
+			isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return fmt.Errorf("invalid field path %q", fieldPath)
+			}
+		}
+	}
+	return nil
+}
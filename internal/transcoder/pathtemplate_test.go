@@ -0,0 +1,109 @@
+package transcoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathTemplate(t *testing.T) {
+	lit := func(s string) PathSegment { return PathSegment{Kind: SegmentLiteral, Literal: s} }
+	wild := PathSegment{Kind: SegmentWildcard}
+	deep := PathSegment{Kind: SegmentDeepWildcard}
+
+	tests := []struct {
+		template  string
+		segments  []PathSegment
+		variables []PathVariable
+		verb      string
+	}{
+		{template: "/"},
+		{template: "/:check", verb: "check"},
+		{template: "/v1/users", segments: []PathSegment{lit("v1"), lit("users")}},
+		{template: "/v1/users/", segments: []PathSegment{lit("v1"), lit("users")}},
+		{
+			template:  "/v1/users/{id}",
+			segments:  []PathSegment{lit("v1"), lit("users"), wild},
+			variables: []PathVariable{{FieldPath: "id", Start: 2, End: 3}},
+		},
+		{
+			template:  "/v1/{name=shelves/*/books/*}",
+			segments:  []PathSegment{lit("v1"), lit("shelves"), wild, lit("books"), wild},
+			variables: []PathVariable{{FieldPath: "name", Start: 1, End: 5}},
+		},
+		{
+			template:  "/v1/{book.name=shelves/*}/pages/{page}",
+			segments:  []PathSegment{lit("v1"), lit("shelves"), wild, lit("pages"), wild},
+			variables: []PathVariable{{FieldPath: "book.name", Start: 1, End: 3}, {FieldPath: "page", Start: 4, End: 5}},
+		},
+		{
+			template:  "/v1/files/{path=**}",
+			segments:  []PathSegment{lit("v1"), lit("files"), deep},
+			variables: []PathVariable{{FieldPath: "path", Start: 2, End: 3}},
+		},
+		{template: "/v1/*/items/**", segments: []PathSegment{lit("v1"), wild, lit("items"), deep}},
+		{
+			template:  "/v1/users/{id}:activate",
+			segments:  []PathSegment{lit("v1"), lit("users"), wild},
+			variables: []PathVariable{{FieldPath: "id", Start: 2, End: 3}},
+			verb:      "activate",
+		},
+		{
+			template:  "/v1/{name=projects/*/locations/**}:batchGet",
+			segments:  []PathSegment{lit("v1"), lit("projects"), wild, lit("locations"), deep},
+			variables: []PathVariable{{FieldPath: "name", Start: 1, End: 5}},
+			verb:      "batchGet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			tpl, err := ParsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate() error = %v", err)
+			}
+			if tpl.Template != tt.template {
+				t.Errorf("Template = %q, want %q", tpl.Template, tt.template)
+			}
+			if len(tpl.Segments) != 0 || len(tt.segments) != 0 {
+				if !reflect.DeepEqual(tpl.Segments, tt.segments) {
+					t.Errorf("Segments = %+v, want %+v", tpl.Segments, tt.segments)
+				}
+			}
+			if len(tpl.Variables) != 0 || len(tt.variables) != 0 {
+				if !reflect.DeepEqual(tpl.Variables, tt.variables) {
+					t.Errorf("Variables = %+v, want %+v", tpl.Variables, tt.variables)
+				}
+			}
+			if tpl.Verb != tt.verb {
+				t.Errorf("Verb = %q, want %q", tpl.Verb, tt.verb)
+			}
+		})
+	}
+}
+
+func TestParsePathTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"v1/users",
+		"/v1/**/users",
+		"/v1/{name=**}/users",
+		"/v1/{id}/{id}",
+		"/v1/{a.b}/x/{a.b=*}",
+		"/v1/{name=shelves/{id}}",
+		"/v1/{id",
+		"/v1/{}",
+		"/v1/{1id}",
+		"/v1/{a..b}",
+		"/v1/{id=}",
+		"/v1//users",
+		"/v1/users:",
+		"/v1/users:a:b",
+		"/v1/users:a/b",
+		"/v1/us=ers",
+	} {
+		t.Run(template, func(t *testing.T) {
+			if tpl, err := ParsePathTemplate(template); err == nil {
+				t.Errorf("ParsePathTemplate(%q) = %+v, want error", template, tpl)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package transcoder
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DescriptorKey 描述符集标识 同一服务同一版本的所有实例共享一份解析结果
+// Digest 为描述符内容指纹 版本号未变但内容变化时同样视为新版本
+type DescriptorKey struct {
+	Service string
+	Version string
+	Digest  string
+}
+
+func (k DescriptorKey) String() string {
+	digest := k.Digest
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return fmt.Sprintf("%s@%s#%s", k.Service, k.Version, digest)
+}
+
+// DescriptorSet 已解析的描述符集 由服务池与其下所有 invoker 引用
+// 引用计数归零时从注册表移除
+type DescriptorSet struct {
+	key   DescriptorKey
+	files []*desc.FileDescriptor
+	types *dynamicpb.Types
+
+	registry *DescriptorRegistry
+	refs     int // 由 registry.mu 保护
+}
+
+// Key 描述符集标识
+func (s *DescriptorSet) Key() DescriptorKey {
+	return s.key
+}
+
+// Files 文件描述符列表
+func (s *DescriptorSet) Files() []*desc.FileDescriptor {
+	return s.files
+}
+
+// Retain 增加一次引用 调用方必须已持有该描述符集的引用
+func (s *DescriptorSet) Retain() {
+	s.registry.mu.Lock()
+	s.refs++
+	s.registry.mu.Unlock()
+}
+
+// Release 释放一次引用 最后一个引用释放后从注册表移除
+func (s *DescriptorSet) Release() {
+	reg := s.registry
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	if reg.sets[s.key] == s {
+		delete(reg.sets, s.key)
+	}
+	log.Printf("Debug: released descriptors %s", s.key)
+}
+
+// DescriptorRegistry 共享描述符注册表 每个服务版本只解析一次
+type DescriptorRegistry struct {
+	sets map[DescriptorKey]*DescriptorSet
+	mu   sync.Mutex
+}
+
+func NewDescriptorRegistry() *DescriptorRegistry {
+	return &DescriptorRegistry{
+		sets: make(map[DescriptorKey]*DescriptorSet),
+	}
+}
+
+// Acquire 获取描述符集并增加一次引用 不存在时解析 fds 并加入注册表
+func (reg *DescriptorRegistry) Acquire(key DescriptorKey, fds *descriptorpb.FileDescriptorSet) (*DescriptorSet, error) {
+	reg.mu.Lock()
+	if set, ok := reg.sets[key]; ok {
+		set.refs++
+		reg.mu.Unlock()
+		return set, nil
+	}
+	reg.mu.Unlock()
+
+	// 在锁外解析 描述符集可能较大
+	set, err := newDescriptorSet(key, fds)
+	if err != nil {
+		return nil, err
+	}
+	set.registry = reg
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	// 并发解析同一版本时保留先加入的一份
+	if existing, ok := reg.sets[key]; ok {
+		existing.refs++
+		return existing, nil
+	}
+	set.refs = 1
+	reg.sets[key] = set
+	log.Printf("Debug: loaded descriptors %s (%d files)", key, len(set.files))
+	return set, nil
+}
+
+// newDescriptorSet 解析描述符并构建类型注册表
+func newDescriptorSet(key DescriptorKey, fds *descriptorpb.FileDescriptorSet) (*DescriptorSet, error) {
+	if fds == nil {
+		return nil, fmt.Errorf("empty descriptor set for %s", key.Service)
+	}
+	files, err := CreateFileDescriptors(fds)
+	if err != nil {
+		return nil, err
+	}
+	types, err := newTypes(files)
+	if err != nil {
+		return nil, err
+	}
+	return &DescriptorSet{
+		key:   key,
+		files: files,
+		types: types,
+	}, nil
+}
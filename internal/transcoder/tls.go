@@ -0,0 +1,177 @@
+package transcoder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// tlsReloadInterval 两次检查证书文件变化的最小间隔
+const tlsReloadInterval = time.Second
+
+// TLSOptions 上游传输安全配置
+type TLSOptions struct {
+	CAFile     string   // 校验服务端证书的 CA 包 为空时使用系统 CA
+	CertFile   string   // 客户端证书(mTLS)
+	KeyFile    string   // 客户端私钥(mTLS)
+	ServerName string   // 覆盖 SNI 与证书校验使用的服务端名称 为空时使用实例地址中的主机名
+	SPIFFEIDs  []string // 允许的服务端 SPIFFE ID 配置后按 URI SAN 校验而非主机名 仅含信任域时匹配该域下任意 ID
+}
+
+// ClientCredentials 支持证书热更新的客户端 TLS 凭证
+// 握手时检查证书文件是否变化 变化后新建立的连接使用新证书 已建立的连接不受影响
+type ClientCredentials struct {
+	opts   TLSOptions
+	spiffe []*url.URL
+
+	mu        sync.Mutex
+	roots     *x509.CertPool   // nil 表示系统 CA
+	cert      *tls.Certificate // nil 表示不出示客户端证书
+	modTimes  [3]time.Time     // CA、证书、私钥文件的修改时间
+	lastCheck time.Time
+}
+
+// NewClientCredentials 加载证书文件并创建客户端凭证
+func NewClientCredentials(opts TLSOptions) (*ClientCredentials, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be configured together")
+	}
+	c := &ClientCredentials{opts: opts}
+	for _, id := range opts.SPIFFEIDs {
+		u, err := url.Parse(strings.TrimSpace(id))
+		if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			return nil, fmt.Errorf("invalid SPIFFE ID %q, expected spiffe://<trust-domain>[/<path>]", id)
+		}
+		c.spiffe = append(c.spiffe, u)
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TransportCredentials 用于 grpc.WithTransportCredentials
+// 服务端证书在 VerifyConnection 中按当前 CA 校验 以便 CA 热更新
+func (c *ClientCredentials) TransportCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(&tls.Config{
+		ServerName:           c.opts.ServerName,
+		MinVersion:           tls.VersionTLS12,
+		InsecureSkipVerify:   true,
+		GetClientCertificate: c.clientCertificate,
+		VerifyConnection:     c.verify,
+	})
+}
+
+// load 读取证书文件并记录修改时间
+func (c *ClientCredentials) load() error {
+	var roots *x509.CertPool
+	if c.opts.CAFile != "" {
+		pem, err := os.ReadFile(c.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", c.opts.CAFile)
+		}
+	}
+	var cert *tls.Certificate
+	if c.opts.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.opts.CertFile, c.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &pair
+	}
+
+	c.roots, c.cert = roots, cert
+	c.modTimes = c.stat()
+	c.lastCheck = time.Now()
+	return nil
+}
+
+// stat 获取证书文件的修改时间 未配置或无法访问的文件为零值
+func (c *ClientCredentials) stat() [3]time.Time {
+	var out [3]time.Time
+	for i, name := range []string{c.opts.CAFile, c.opts.CertFile, c.opts.KeyFile} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			out[i] = info.ModTime()
+		}
+	}
+	return out
+}
+
+// current 获取当前证书 文件变化时重新加载 加载失败时沿用旧证书
+func (c *ClientCredentials) current() (*x509.CertPool, *tls.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastCheck) >= tlsReloadInterval {
+		c.lastCheck = now
+		if c.stat() != c.modTimes {
+			if err := c.load(); err != nil {
+				log.Printf("Warning: failed to reload upstream TLS certificates, keeping previous ones: %v", err)
+				c.modTimes = c.stat()
+			} else {
+				log.Printf("Reloaded upstream TLS certificates")
+			}
+		}
+	}
+	return c.roots, c.cert
+}
+
+func (c *ClientCredentials) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if _, cert := c.current(); cert != nil {
+		return cert, nil
+	}
+	return &tls.Certificate{}, nil
+}
+
+// verify 校验服务端证书链 配置 SPIFFE ID 时校验 URI SAN 否则校验主机名
+func (c *ClientCredentials) verify(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	roots, _ := c.current()
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if len(c.spiffe) == 0 {
+		opts.DNSName = cs.ServerName
+	}
+	leaf := cs.PeerCertificates[0]
+	if _, err := leaf.Verify(opts); err != nil {
+		return err
+	}
+	if len(c.spiffe) == 0 {
+		return nil
+	}
+	for _, uri := range leaf.URIs {
+		if uri.Scheme != "spiffe" {
+			continue
+		}
+		for _, allowed := range c.spiffe {
+			if uri.Host == allowed.Host && (allowed.Path == "" || allowed.Path == "/" || uri.Path == allowed.Path) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("server certificate SPIFFE ID %v is not allowed", leaf.URIs)
+}
@@ -0,0 +1,384 @@
+// Pilot 网关策略选项 服务在 proto 中声明 随描述符发布到 etcd
+//
+// 用法:
+//   import "pilot/gateway/v1/options.proto";
+//
+//   service UserService {
+//     option (pilot.gateway.v1.service_policy) = { auth_required: true };
+//     rpc Login(LoginRequest) returns (LoginReply) {
+//       option (google.api.http) = { post: "/v1/login" body: "*" };
+//       option (pilot.gateway.v1.method_policy) = { auth_required: false max_body_bytes: 4096 };
+//     }
+//   }
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: pilot/gateway/v1/options.proto
+
+package gatewayv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Policy 路由策略 未设置的字段沿用上一级配置
+type Policy struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 开启 JWT 认证时是否必须携带有效令牌
+	AuthRequired *bool `protobuf:"varint,1,opt,name=auth_required,json=authRequired,proto3,oneof" json:"auth_required,omitempty"`
+	// 调用方未指定超时时使用的超时
+	Timeout *durationpb.Duration `protobuf:"bytes,2,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	// 调用方通过 grpc-timeout / X-Request-Timeout 指定超时的上限
+	MaxTimeout *durationpb.Duration `protobuf:"bytes,3,opt,name=max_timeout,json=maxTimeout,proto3" json:"max_timeout,omitempty"`
+	// 请求体大小上限(字节)
+	MaxBodyBytes int64 `protobuf:"varint,4,opt,name=max_body_bytes,json=maxBodyBytes,proto3" json:"max_body_bytes,omitempty"`
+	// 是否幂等 幂等方法失败时允许换实例重试
+	Idempotent *bool `protobuf:"varint,5,opt,name=idempotent,proto3,oneof" json:"idempotent,omitempty"`
+	// 响应缓存 仅用于 GET 一元调用
+	Cache *Cache `protobuf:"bytes,6,opt,name=cache,proto3" json:"cache,omitempty"`
+	// 限流
+	RateLimit     *RateLimit `protobuf:"bytes,7,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Policy) Reset() {
+	*x = Policy{}
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Policy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Policy) ProtoMessage() {}
+
+func (x *Policy) ProtoReflect() protoreflect.Message {
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Policy.ProtoReflect.Descriptor instead.
+func (*Policy) Descriptor() ([]byte, []int) {
+	return file_pilot_gateway_v1_options_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Policy) GetAuthRequired() bool {
+	if x != nil && x.AuthRequired != nil {
+		return *x.AuthRequired
+	}
+	return false
+}
+
+func (x *Policy) GetTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.Timeout
+	}
+	return nil
+}
+
+func (x *Policy) GetMaxTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.MaxTimeout
+	}
+	return nil
+}
+
+func (x *Policy) GetMaxBodyBytes() int64 {
+	if x != nil {
+		return x.MaxBodyBytes
+	}
+	return 0
+}
+
+func (x *Policy) GetIdempotent() bool {
+	if x != nil && x.Idempotent != nil {
+		return *x.Idempotent
+	}
+	return false
+}
+
+func (x *Policy) GetCache() *Cache {
+	if x != nil {
+		return x.Cache
+	}
+	return nil
+}
+
+func (x *Policy) GetRateLimit() *RateLimit {
+	if x != nil {
+		return x.RateLimit
+	}
+	return nil
+}
+
+// Cache 响应缓存策略
+type Cache struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 缓存时长 为 0 时不缓存
+	Ttl *durationpb.Duration `protobuf:"bytes,1,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// 参与缓存键的请求头 未列出 Authorization 时携带 Authorization 的请求不使用缓存
+	VaryHeaders   []string `protobuf:"bytes,2,rep,name=vary_headers,json=varyHeaders,proto3" json:"vary_headers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Cache) Reset() {
+	*x = Cache{}
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Cache) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cache) ProtoMessage() {}
+
+func (x *Cache) ProtoReflect() protoreflect.Message {
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cache.ProtoReflect.Descriptor instead.
+func (*Cache) Descriptor() ([]byte, []int) {
+	return file_pilot_gateway_v1_options_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Cache) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *Cache) GetVaryHeaders() []string {
+	if x != nil {
+		return x.VaryHeaders
+	}
+	return nil
+}
+
+// RateLimit 令牌桶限流策略
+type RateLimit struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 每秒补充的令牌数 为 0 时不限流
+	Rate float64 `protobuf:"fixed64,1,opt,name=rate,proto3" json:"rate,omitempty"`
+	// 桶容量 即允许的突发请求数 为 0 时取 rate 向上取整
+	Burst uint32 `protobuf:"varint,2,opt,name=burst,proto3" json:"burst,omitempty"`
+	// 限流键 client_ip | header:<name> | claim:<name> | route 为空时为 client_ip
+	Key           string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RateLimit) Reset() {
+	*x = RateLimit{}
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RateLimit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RateLimit) ProtoMessage() {}
+
+func (x *RateLimit) ProtoReflect() protoreflect.Message {
+	mi := &file_pilot_gateway_v1_options_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RateLimit.ProtoReflect.Descriptor instead.
+func (*RateLimit) Descriptor() ([]byte, []int) {
+	return file_pilot_gateway_v1_options_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RateLimit) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *RateLimit) GetBurst() uint32 {
+	if x != nil {
+		return x.Burst
+	}
+	return 0
+}
+
+func (x *RateLimit) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+var file_pilot_gateway_v1_options_proto_extTypes = []protoimpl.ExtensionInfo{
+	{
+		ExtendedType:  (*descriptorpb.ServiceOptions)(nil),
+		ExtensionType: (*Policy)(nil),
+		Field:         87001,
+		Name:          "pilot.gateway.v1.service_policy",
+		Tag:           "bytes,87001,opt,name=service_policy",
+		Filename:      "pilot/gateway/v1/options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MethodOptions)(nil),
+		ExtensionType: (*Policy)(nil),
+		Field:         87001,
+		Name:          "pilot.gateway.v1.method_policy",
+		Tag:           "bytes,87001,opt,name=method_policy",
+		Filename:      "pilot/gateway/v1/options.proto",
+	},
+}
+
+// Extension fields to descriptorpb.ServiceOptions.
+var (
+	// 服务内全部方法的默认策略
+	//
+	// optional pilot.gateway.v1.Policy service_policy = 87001;
+	E_ServicePolicy = &file_pilot_gateway_v1_options_proto_extTypes[0]
+)
+
+// Extension fields to descriptorpb.MethodOptions.
+var (
+	// 方法策略 覆盖 service_policy 中的同名字段
+	//
+	// optional pilot.gateway.v1.Policy method_policy = 87001;
+	E_MethodPolicy = &file_pilot_gateway_v1_options_proto_extTypes[1]
+)
+
+var File_pilot_gateway_v1_options_proto protoreflect.FileDescriptor
+
+const file_pilot_gateway_v1_options_proto_rawDesc = "" +
+	"\n" +
+	"\x1epilot/gateway/v1/options.proto\x12\x10pilot.gateway.v1\x1a google/protobuf/descriptor.proto\x1a\x1egoogle/protobuf/duration.proto\"\xfa\x02\n" +
+	"\x06Policy\x12(\n" +
+	"\rauth_required\x18\x01 \x01(\bH\x00R\fauthRequired\x88\x01\x01\x123\n" +
+	"\atimeout\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\atimeout\x12:\n" +
+	"\vmax_timeout\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\n" +
+	"maxTimeout\x12$\n" +
+	"\x0emax_body_bytes\x18\x04 \x01(\x03R\fmaxBodyBytes\x12#\n" +
+	"\n" +
+	"idempotent\x18\x05 \x01(\bH\x01R\n" +
+	"idempotent\x88\x01\x01\x12-\n" +
+	"\x05cache\x18\x06 \x01(\v2\x17.pilot.gateway.v1.CacheR\x05cache\x12:\n" +
+	"\n" +
+	"rate_limit\x18\a \x01(\v2\x1b.pilot.gateway.v1.RateLimitR\trateLimitB\x10\n" +
+	"\x0e_auth_requiredB\r\n" +
+	"\v_idempotent\"W\n" +
+	"\x05Cache\x12+\n" +
+	"\x03ttl\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12!\n" +
+	"\fvary_headers\x18\x02 \x03(\tR\vvaryHeaders\"G\n" +
+	"\tRateLimit\x12\x12\n" +
+	"\x04rate\x18\x01 \x01(\x01R\x04rate\x12\x14\n" +
+	"\x05burst\x18\x02 \x01(\rR\x05burst\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key:b\n" +
+	"\x0eservice_policy\x12\x1f.google.protobuf.ServiceOptions\x18٧\x05 \x01(\v2\x18.pilot.gateway.v1.PolicyR\rservicePolicy:_\n" +
+	"\rmethod_policy\x12\x1e.google.protobuf.MethodOptions\x18٧\x05 \x01(\v2\x18.pilot.gateway.v1.PolicyR\fmethodPolicyB(Z&pilot/proto/pilot/gateway/v1;gatewayv1b\x06proto3"
+
+var (
+	file_pilot_gateway_v1_options_proto_rawDescOnce sync.Once
+	file_pilot_gateway_v1_options_proto_rawDescData []byte
+)
+
+func file_pilot_gateway_v1_options_proto_rawDescGZIP() []byte {
+	file_pilot_gateway_v1_options_proto_rawDescOnce.Do(func() {
+		file_pilot_gateway_v1_options_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pilot_gateway_v1_options_proto_rawDesc), len(file_pilot_gateway_v1_options_proto_rawDesc)))
+	})
+	return file_pilot_gateway_v1_options_proto_rawDescData
+}
+
+var file_pilot_gateway_v1_options_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_pilot_gateway_v1_options_proto_goTypes = []any{
+	(*Policy)(nil),                      // 0: pilot.gateway.v1.Policy
+	(*Cache)(nil),                       // 1: pilot.gateway.v1.Cache
+	(*RateLimit)(nil),                   // 2: pilot.gateway.v1.RateLimit
+	(*durationpb.Duration)(nil),         // 3: google.protobuf.Duration
+	(*descriptorpb.ServiceOptions)(nil), // 4: google.protobuf.ServiceOptions
+	(*descriptorpb.MethodOptions)(nil),  // 5: google.protobuf.MethodOptions
+}
+var file_pilot_gateway_v1_options_proto_depIdxs = []int32{
+	3, // 0: pilot.gateway.v1.Policy.timeout:type_name -> google.protobuf.Duration
+	3, // 1: pilot.gateway.v1.Policy.max_timeout:type_name -> google.protobuf.Duration
+	1, // 2: pilot.gateway.v1.Policy.cache:type_name -> pilot.gateway.v1.Cache
+	2, // 3: pilot.gateway.v1.Policy.rate_limit:type_name -> pilot.gateway.v1.RateLimit
+	3, // 4: pilot.gateway.v1.Cache.ttl:type_name -> google.protobuf.Duration
+	4, // 5: pilot.gateway.v1.service_policy:extendee -> google.protobuf.ServiceOptions
+	5, // 6: pilot.gateway.v1.method_policy:extendee -> google.protobuf.MethodOptions
+	0, // 7: pilot.gateway.v1.service_policy:type_name -> pilot.gateway.v1.Policy
+	0, // 8: pilot.gateway.v1.method_policy:type_name -> pilot.gateway.v1.Policy
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	7, // [7:9] is the sub-list for extension type_name
+	5, // [5:7] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_pilot_gateway_v1_options_proto_init() }
+func file_pilot_gateway_v1_options_proto_init() {
+	if File_pilot_gateway_v1_options_proto != nil {
+		return
+	}
+	file_pilot_gateway_v1_options_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pilot_gateway_v1_options_proto_rawDesc), len(file_pilot_gateway_v1_options_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 2,
+			NumServices:   0,
+		},
+		GoTypes:           file_pilot_gateway_v1_options_proto_goTypes,
+		DependencyIndexes: file_pilot_gateway_v1_options_proto_depIdxs,
+		MessageInfos:      file_pilot_gateway_v1_options_proto_msgTypes,
+		ExtensionInfos:    file_pilot_gateway_v1_options_proto_extTypes,
+	}.Build()
+	File_pilot_gateway_v1_options_proto = out.File
+	file_pilot_gateway_v1_options_proto_goTypes = nil
+	file_pilot_gateway_v1_options_proto_depIdxs = nil
+}